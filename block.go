@@ -0,0 +1,176 @@
+package templatex
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template/parse"
+)
+
+// blockActions are the functions that take the body enclosed by {{end}} like
+// {{block}}. the body is parsed as the template, and passed to the function as
+// the last argument that renders it lazily. their names are reserved by the
+// runtime, so the user functions are never treated as the block actions.
+var blockActions = map[string]bool{
+	"component": true,
+	"push":      true,
+	"cache":     true,
+}
+
+// match {{name
+var reBlockAction = regexp.MustCompile(`\{\{(?:-\s)?\s*([A-Za-z_][A-Za-z0-9_]*)`)
+
+// bodyPrefix returns the prefix of the names of the body templates in f
+func bodyPrefix(f *File) string {
+	return "body:" + f.name + "#"
+}
+
+// actionEnd returns the index after "}}" of the action that contains the
+// offset, or -1 if the action is not closed.
+func actionEnd(text string, offset int) int {
+	for i := offset; i < len(text); i++ {
+		switch c := text[i]; c {
+		case '"', '\'', '`':
+			// skip quoted string
+			for i++; i < len(text) && text[i] != c; i++ {
+				if text[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case '}':
+			if strings.HasPrefix(text[i:], "}}") {
+				return i + 2
+			}
+		}
+	}
+	return -1
+}
+
+// markBlockActions inserts {{block "<name>" .}} after the block actions so that
+// their bodies are parsed as the templates with the {{end}} of the actions.
+// the line numbers of the text are not changed.
+func markBlockActions(f *File, text string) string {
+	b := strings.Builder{}
+	n := 0
+	cur := 0
+	for _, m := range reBlockAction.FindAllStringSubmatchIndex(text, -1) {
+		if m[0] < cur || !blockActions[text[m[2]:m[3]]] {
+			continue
+		}
+		end := actionEnd(text, m[1])
+		if end == -1 {
+			break
+		}
+
+		// move the trim marker of the action to the block
+		n++
+		trim := ""
+		if strings.HasSuffix(text[:end], " -}}") {
+			b.WriteString(text[cur : end-4])
+			b.WriteString("}}")
+			trim = " -"
+		} else {
+			b.WriteString(text[cur:end])
+		}
+		fmt.Fprintf(&b, `{{block "%s%d" .%s}}`, bodyPrefix(f), n, trim)
+		cur = end
+	}
+	if n == 0 {
+		return text
+	}
+	b.WriteString(text[cur:])
+	return b.String()
+}
+
+// bindBody replaces the calls of the body templates in the list with the
+// argument of the preceding block actions, and returns the number of the
+// replaced calls. digest is the digest of the file that contains the bodies.
+func bindBody(list *parse.ListNode, prefix, digest string) (int, error) {
+	if list == nil {
+		return 0, nil
+	}
+
+	n := 0
+	nodes := list.Nodes[:0]
+	for _, node := range list.Nodes {
+		var branch *parse.BranchNode
+		switch node := node.(type) {
+		case *parse.TemplateNode:
+			if !strings.HasPrefix(node.Name, prefix) {
+				break
+			}
+			var a *parse.ActionNode
+			if len(nodes) > 0 {
+				a, _ = nodes[len(nodes)-1].(*parse.ActionNode)
+			}
+			if a == nil || len(a.Pipe.Decl) > 0 || len(a.Pipe.Cmds) != 1 {
+				return n, fmt.Errorf("line %d: block action must be used as {{name args...}}", node.Line)
+			}
+
+			// pass {{body "<name>" "<digest>" .}} as the last argument
+			cmd := a.Pipe.Cmds[0]
+			cmd.Args = append(cmd.Args, &parse.PipeNode{
+				NodeType: parse.NodePipe,
+				Pos:      node.Pos,
+				Line:     node.Line,
+				Cmds: []*parse.CommandNode{{
+					NodeType: parse.NodeCommand,
+					Pos:      node.Pos,
+					Args: []parse.Node{
+						parse.NewIdentifier("body").SetPos(node.Pos),
+						&parse.StringNode{
+							NodeType: parse.NodeString,
+							Pos:      node.Pos,
+							Quoted:   fmt.Sprintf("%q", node.Name),
+							Text:     node.Name,
+						},
+						&parse.StringNode{
+							NodeType: parse.NodeString,
+							Pos:      node.Pos,
+							Quoted:   fmt.Sprintf("%q", digest),
+							Text:     digest,
+						},
+						&parse.DotNode{
+							NodeType: parse.NodeDot,
+							Pos:      node.Pos,
+						},
+					},
+				}},
+			})
+			n++
+			continue
+		case *parse.IfNode:
+			branch = &node.BranchNode
+		case *parse.RangeNode:
+			branch = &node.BranchNode
+		case *parse.WithNode:
+			branch = &node.BranchNode
+		}
+		nodes = append(nodes, node)
+		if branch == nil {
+			continue
+		}
+		for _, l := range []*parse.ListNode{branch.List, branch.ElseList} {
+			c, err := bindBody(l, prefix, digest)
+			if n += c; err != nil {
+				return n, err
+			}
+		}
+	}
+	list.Nodes = nodes
+	return n, nil
+}
+
+// bindBlockActions binds the bodies of the block actions in the templates
+// defined by f to the actions
+func (t *Template) bindBlockActions(f *File) error {
+	prefix := bodyPrefix(f)
+	for _, tree := range t.renderer.Trees(f.tmpl) {
+		if tree.ParseName != f.name {
+			continue
+		} else if _, err := bindBody(tree.Root, prefix, f.digest); err != nil {
+			return fmt.Errorf("%s:%v", f.name, err)
+		}
+	}
+	return nil
+}
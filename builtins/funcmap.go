@@ -312,6 +312,72 @@ func (s *HashSet) Unset(v interface{}) bool {
 	return false
 }
 
+type Scratch struct {
+	data map[string]interface{}
+}
+
+func NewScratch() *Scratch {
+	return &Scratch{
+		data: map[string]interface{}{},
+	}
+}
+
+func (s *Scratch) Set(key string, v interface{}) *Scratch {
+	s.data[key] = v
+	return s
+}
+
+func (s *Scratch) Get(key string) interface{} {
+	return s.data[key]
+}
+
+func (s *Scratch) Delete(key string) bool {
+	if _, exists := s.data[key]; exists {
+		delete(s.data, key)
+		return true
+	}
+	return false
+}
+
+// Incr increments the value of key by 1, or by the sum of n if specified,
+// and returns the new value. the value that does not exist is treated as 0.
+func (s *Scratch) Incr(key string, n ...int) (int, error) {
+	delta := 1
+	if len(n) > 0 {
+		delta = 0
+		for _, v := range n {
+			delta += v
+		}
+	}
+
+	var cur int
+	if v, exists := s.data[key]; exists {
+		i, ok := v.(int)
+		if !ok {
+			return 0, fmt.Errorf("value of %q is not int: %T", key, v)
+		}
+		cur = i
+	}
+	cur += delta
+	s.data[key] = cur
+	return cur, nil
+}
+
+// Append appends values to the Slice of key, and returns the Slice. the Slice
+// is created if the value does not exist.
+func (s *Scratch) Append(key string, v ...interface{}) (*Slice, error) {
+	if cur, exists := s.data[key]; exists {
+		list, ok := cur.(*Slice)
+		if !ok {
+			return nil, fmt.Errorf("value of %q is not *Slice: %T", key, cur)
+		}
+		return list.Append(v...), nil
+	}
+	list := NewSlice(v...)
+	s.data[key] = list
+	return list, nil
+}
+
 func FuncMap() map[string]interface{} {
 	return map[string]interface{}{
 		// functions
@@ -332,5 +398,6 @@ func FuncMap() map[string]interface{} {
 		// helper data structure
 		"NewSlice":   NewSlice,
 		"NewHashSet": NewHashSet,
+		"NewScratch": NewScratch,
 	}
 }
@@ -58,6 +58,8 @@ func Test_FuncMap(t *testing.T) {
 			equalFunc(t, v, NewSlice)
 		case "NewHashSet":
 			equalFunc(t, v, NewHashSet)
+		case "NewScratch":
+			equalFunc(t, v, NewScratch)
 		default:
 			t.Fatalf("unknown built-in function has been exported: %q", k)
 		}
@@ -541,3 +543,49 @@ func Test_HashSet(t *testing.T) {
 	// test that returns true if value is stored in hashset
 	assert.True(t, s.Set("foo"))
 }
+
+func Test_Scratch(t *testing.T) {
+	// test that returns new instance of Scratch
+	s := NewScratch()
+	assert.Equal(t, &Scratch{data: map[string]interface{}{}}, s)
+
+	// test that set and get value
+	assert.Equal(t, s, s.Set("foo", "bar"))
+	assert.Equal(t, "bar", s.Get("foo"))
+	assert.Nil(t, s.Get("unknown"))
+
+	// test that returns true if value has been deleted
+	assert.True(t, s.Delete("foo"))
+	assert.False(t, s.Delete("foo"))
+	assert.Nil(t, s.Get("foo"))
+
+	// test that increment value
+	n, err := s.Incr("count")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = s.Incr("count", 2, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, n)
+	n, err = s.Incr("count", -10)
+	assert.NoError(t, err)
+	assert.Equal(t, -4, n)
+	assert.Equal(t, -4, s.Get("count"))
+
+	// test that returns an error if value is not int
+	s.Set("foo", "bar")
+	_, err = s.Incr("foo")
+	assert.Error(t, err)
+
+	// test that append values to the Slice
+	list, err := s.Append("list", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"a"}, list.Value())
+	list, err = s.Append("list", "b", "c")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"a", "b", "c"}, list.Value())
+	assert.Equal(t, list, s.Get("list"))
+
+	// test that returns an error if value is not Slice
+	_, err = s.Append("foo", "a")
+	assert.Error(t, err)
+}
@@ -0,0 +1,165 @@
+package templatex
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Bus delivers the names of the templates to be uncached between the
+// runtimes. the subscribers may also receive the names that published by
+// themselves.
+type Bus interface {
+	Publish(name string) error
+	Subscribe(fn func(name string)) error
+	Close() error
+}
+
+type subscribers struct {
+	sync.Mutex
+	fns []func(name string)
+}
+
+func (s *subscribers) add(fn func(name string)) {
+	s.Lock()
+	s.fns = append(s.fns, fn)
+	s.Unlock()
+}
+
+func (s *subscribers) clear() {
+	s.Lock()
+	s.fns = nil
+	s.Unlock()
+}
+
+func (s *subscribers) dispatch(name string) {
+	s.Lock()
+	fns := s.fns
+	s.Unlock()
+	for _, fn := range fns {
+		fn(name)
+	}
+}
+
+type MemoryBus struct {
+	subs subscribers
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+func (b *MemoryBus) Publish(name string) error {
+	b.subs.dispatch(name)
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(fn func(name string)) error {
+	b.subs.add(fn)
+	return nil
+}
+
+func (b *MemoryBus) Close() error {
+	b.subs.clear()
+	return nil
+}
+
+// udpMagic is prepended to each datagram to ignore unrelated packets
+var udpMagic = []byte("templatex\x00")
+
+const udpMaxPacketSize = 65507
+
+type UDPBus struct {
+	conn  *net.UDPConn
+	subs  subscribers
+	mu    sync.Mutex
+	peers []*net.UDPAddr
+	done  chan struct{}
+}
+
+func NewUDPBus(addr string, peers ...string) (*UDPBus, error) {
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &UDPBus{
+		conn: conn,
+		done: make(chan struct{}),
+	}
+	for _, peer := range peers {
+		if err := b.AddPeer(peer); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	go b.serve()
+
+	return b, nil
+}
+
+func (b *UDPBus) Addr() net.Addr {
+	return b.conn.LocalAddr()
+}
+
+func (b *UDPBus) AddPeer(addr string) error {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.peers = append(b.peers, raddr)
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *UDPBus) serve() {
+	defer close(b.done)
+	buf := make([]byte, udpMaxPacketSize)
+	for {
+		n, _, err := b.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		if msg := buf[:n]; bytes.HasPrefix(msg, udpMagic) {
+			b.subs.dispatch(string(msg[len(udpMagic):]))
+		}
+	}
+}
+
+func (b *UDPBus) Publish(name string) error {
+	msg := append(append([]byte{}, udpMagic...), name...)
+	if len(msg) > udpMaxPacketSize {
+		return fmt.Errorf("name %q is too long to publish", name)
+	}
+
+	b.mu.Lock()
+	peers := b.peers
+	b.mu.Unlock()
+	for _, peer := range peers {
+		if _, err := b.conn.WriteToUDP(msg, peer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *UDPBus) Subscribe(fn func(name string)) error {
+	b.subs.add(fn)
+	return nil
+}
+
+func (b *UDPBus) Close() error {
+	err := b.conn.Close()
+	<-b.done
+	b.subs.clear()
+	return err
+}
@@ -0,0 +1,109 @@
+package templatex
+
+import (
+	"bytes"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mah0x211/templatex/builtins"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBus(t *testing.T) {
+	bus := NewMemoryBus()
+	var a, b []string
+	assert.NoError(t, bus.Subscribe(func(name string) { a = append(a, name) }))
+	assert.NoError(t, bus.Subscribe(func(name string) { b = append(b, name) }))
+
+	// test that published names are delivered to all subscribers
+	assert.NoError(t, bus.Publish("foo.html"))
+	assert.NoError(t, bus.Publish("@bar.html"))
+	assert.Equal(t, []string{"foo.html", "@bar.html"}, a)
+	assert.Equal(t, []string{"foo.html", "@bar.html"}, b)
+
+	// test that names are not delivered after closed
+	assert.NoError(t, bus.Close())
+	assert.NoError(t, bus.Publish("baz.html"))
+	assert.Equal(t, []string{"foo.html", "@bar.html"}, a)
+}
+
+func TestUDPBus(t *testing.T) {
+	b1, err := NewUDPBus("127.0.0.1:0")
+	assert.NoError(t, err)
+	defer b1.Close()
+	b2, err := NewUDPBus("127.0.0.1:0", b1.Addr().String())
+	assert.NoError(t, err)
+	defer b2.Close()
+	assert.NoError(t, b1.AddPeer(b2.Addr().String()))
+
+	recv := make(chan string, 2)
+	assert.NoError(t, b1.Subscribe(func(name string) { recv <- "b1:" + name }))
+	assert.NoError(t, b2.Subscribe(func(name string) { recv <- "b2:" + name }))
+
+	// test that published names are delivered to the peers
+	assert.NoError(t, b1.Publish("foo.html"))
+	select {
+	case v := <-recv:
+		assert.Equal(t, "b2:foo.html", v)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	assert.NoError(t, b2.Publish("@bar.html"))
+	select {
+	case v := <-recv:
+		assert.Equal(t, "b1:@bar.html", v)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	// test that returns an error if peer address is invalid
+	_, err = NewUDPBus("127.0.0.1:0", "invalid address")
+	assert.Error(t, err)
+}
+
+func TestRuntime_Uncache(t *testing.T) {
+	// setup
+	rootdir := "/root/dir/"
+	files := map[string]string{
+		"/root/dir/@include.html": `{{define "@include.html"}}v1{{end}}`,
+		"/root/dir/index.html":    `hello {{template "@include.html"}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[filepath.Join(rootdir, pathname)]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	bus := NewMemoryBus()
+	c1 := NewMapCache()
+	rt1 := NewEx(readfn, c1, builtins.FuncMap())
+	assert.NoError(t, rt1.SetBus(bus))
+	c2 := NewMapCache()
+	rt2 := NewEx(readfn, c2, builtins.FuncMap())
+	assert.NoError(t, rt2.SetBus(bus))
+
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt1.RenderHTML(b, "index.html", nil))
+	assert.Equal(t, "hello v1", b.String())
+	b.Reset()
+	assert.NoError(t, rt2.RenderHTML(b, "index.html", nil))
+	assert.Equal(t, "hello v1", b.String())
+
+	// test that uncache the templates of all runtimes connected to the bus
+	files["/root/dir/@include.html"] = `{{define "@include.html"}}v2{{end}}`
+	assert.NoError(t, rt1.Uncache("@include.html"))
+	assert.Nil(t, c1.Get("index.html"))
+	assert.Nil(t, c2.Get("index.html"))
+	assert.Nil(t, c2.Get("@include.html"))
+
+	b.Reset()
+	assert.NoError(t, rt2.RenderHTML(b, "index.html", nil))
+	assert.Equal(t, "hello v2", b.String())
+
+	// test that uncache the template without bus
+	rt := NewEx(readfn, NewMapCache(), builtins.FuncMap())
+	assert.NoError(t, rt.Uncache("index.html"))
+}
@@ -4,16 +4,48 @@ import "sync"
 
 type File struct {
 	cache  Cache
+	t      xTemplate
+	key    string
 	name   string
+	text   string
+	digest string
 	root   interface{}
 	tmpl   interface{}
+	layout *File
+	meta   FrontMatter
 	parent map[string]*File
 	child  map[string]*File
+	// missing is true if the file is the placeholder of the optional include
+	// that does not exist
+	missing bool
+	// instances of the template set to execute
+	pool sync.Pool
+	// mu guards the fields below, parent and child since the renders and the
+	// bus update or walk them concurrently
+	mu sync.Mutex
+	// uncached is true after the file is uncached or replaced
+	uncached bool
+	// keys of the fragments that depend on the file. they are deleted from
+	// the stores when the file is uncached.
+	fragments map[string]fragmentRef
+	// seq is the sequence number of the last registered fragment, and
+	// pruneAt is the number of the fragments to prune them at
+	seq     uint64
+	pruneAt int
 }
 
-func createFile(cache Cache, name string) *File {
+// fragmentRef is the store of the fragment and the sequence number of its
+// registration
+type fragmentRef struct {
+	store FragmentStore
+	seq   uint64
+}
+
+func createFile(cache Cache, t xTemplate, name string) *File {
 	return &File{
 		cache:  cache,
+		t:      t,
+		key:    name,
 		name:   name,
 		parent: make(map[string]*File),
 		child:  make(map[string]*File),
@@ -24,18 +56,169 @@ func (f *File) Name() string {
 	return f.name
 }
 
+func (f *File) FrontMatter() FrontMatter {
+	return f.meta
+}
+
+// rootName returns the name of the template to execute. it is the top of the
+// layout chain if the file has the layout.
+func (f *File) rootName() string {
+	if f.layout == nil {
+		return f.name
+	}
+	return topLayout(f.layout).name
+}
+
+func topLayout(l *File) *File {
+	for l.layout != nil {
+		l = l.layout
+	}
+	return l
+}
+
 func (f *File) addParent(af *File) {
-	f.parent[af.name] = af
+	f.mu.Lock()
+	f.parent[af.key] = af
+	f.mu.Unlock()
 }
 
 func (f *File) addChild(af *File) {
-	f.child[af.name] = af
+	f.mu.Lock()
+	f.child[af.key] = af
+	f.mu.Unlock()
 }
 
-func (f *File) Uncache() {
-	f.cache.Unset(f.name)
+// parents returns the snapshot of the files that depend on the file
+func (f *File) parents() []*File {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := make([]*File, 0, len(f.parent))
 	for _, p := range f.parent {
-		p.Uncache()
+		list = append(list, p)
+	}
+	return list
+}
+
+// children returns the snapshot of the files that the file depends on
+func (f *File) children() []*File {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := make([]*File, 0, len(f.child))
+	for _, c := range f.child {
+		list = append(list, c)
+	}
+	return list
+}
+
+// inherit takes over the dependents of the old file that is replaced by f in
+// the cache, so that they are uncached together with f.
+func (f *File) inherit(old *File) {
+	old.mu.Lock()
+	parent := make(map[string]*File, len(old.parent))
+	for k, p := range old.parent {
+		parent[k] = p
+	}
+	fragments := old.fragments
+	old.fragments = nil
+	// the fragments rendered from the old file afterwards are not taken over
+	old.uncached = true
+	old.mu.Unlock()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for k, p := range parent {
+		if _, exists := f.parent[k]; !exists {
+			f.parent[k] = p
+		}
+	}
+	for k, ref := range fragments {
+		f.setFragment(ref.store, k)
+	}
+}
+
+// minPruneFragments is the number of the fragments that the file registers
+// before pruning the fragments that are no longer stored
+const minPruneFragments = 64
+
+// setFragment registers the fragment. f.mu must be locked.
+func (f *File) setFragment(store FragmentStore, key string) {
+	if f.fragments == nil {
+		f.fragments = make(map[string]fragmentRef)
+	}
+	f.seq++
+	f.fragments[key] = fragmentRef{
+		store: store,
+		seq:   f.seq,
+	}
+}
+
+// addFragment registers the key of the fragment stored in the store. it
+// returns false if the file has been uncached, then the fragment must be
+// deleted by the caller since nothing deletes it.
+// the fragments that are expired or deleted from the stores are pruned each
+// time the number of the fragments is doubled, so the keys that are never
+// used again do not remain.
+func (f *File) addFragment(store FragmentStore, key string) bool {
+	f.mu.Lock()
+	if f.uncached {
+		f.mu.Unlock()
+		return false
+	}
+	f.setFragment(store, key)
+	if n := len(f.fragments); n < minPruneFragments || n < f.pruneAt {
+		f.mu.Unlock()
+		return true
+	}
+	f.pruneAt = len(f.fragments) * 2
+	fragments := make(map[string]fragmentRef, len(f.fragments))
+	for k, ref := range f.fragments {
+		fragments[k] = ref
+	}
+	f.mu.Unlock()
+
+	// the stores are not accessed while locking
+	var stale []string
+	for k, ref := range fragments {
+		if _, ok := ref.store.Get(k); !ok {
+			stale = append(stale, k)
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, k := range stale {
+		// the fragment registered again during the pruning is kept
+		if ref, ok := f.fragments[k]; ok && ref.seq == fragments[k].seq {
+			delete(f.fragments, k)
+		}
+	}
+	f.pruneAt = len(f.fragments) * 2
+	return true
+}
+
+func (f *File) Uncache() {
+	f.uncache(make(map[*File]bool))
+}
+
+// uncache uncaches the file and its dependents. visited stops walking the
+// cycles made by the includes at the execution time.
+func (f *File) uncache(visited map[*File]bool) {
+	if visited[f] {
+		return
+	}
+	visited[f] = true
+
+	f.cache.Unset(f.key)
+	f.mu.Lock()
+	fragments := f.fragments
+	f.fragments = nil
+	f.uncached = true
+	f.mu.Unlock()
+	for k, ref := range fragments {
+		ref.store.Delete(k)
+	}
+	for _, p := range f.parents() {
+		p.uncache(visited)
 	}
 }
 
@@ -61,7 +244,7 @@ func (c NopCache) Unset(_ string)        {}
 
 type MapCache struct {
 	Cache
-	sync.Mutex
+	sync.RWMutex
 	data map[string]*File
 }
 
@@ -72,8 +255,8 @@ func NewMapCache() Cache {
 }
 
 func (c *MapCache) Get(k string) *File {
-	c.Lock()
-	defer c.Unlock()
+	c.RLock()
+	defer c.RUnlock()
 	return c.data[k]
 }
 
@@ -88,3 +271,48 @@ func (c *MapCache) Unset(k string) {
 	delete(c.data, k)
 	c.Unlock()
 }
+
+func (c *MapCache) Files() map[string]*File {
+	c.RLock()
+	defer c.RUnlock()
+	files := make(map[string]*File, len(c.data))
+	for k, f := range c.data {
+		files[k] = f
+	}
+	return files
+}
+
+// FileLister is implemented by the Cache that can list its files
+type FileLister interface {
+	Files() map[string]*File
+}
+
+// FrozenCache is the read-only cache that can be read without locking
+type FrozenCache struct {
+	Cache
+	data map[string]*File
+}
+
+func NewFrozenCache(files map[string]*File) Cache {
+	data := make(map[string]*File, len(files))
+	for k, f := range files {
+		data[k] = f
+	}
+	return &FrozenCache{
+		data: data,
+	}
+}
+
+func (c *FrozenCache) Get(k string) *File {
+	return c.data[k]
+}
+func (c *FrozenCache) Set(_ string, _ *File) {}
+func (c *FrozenCache) Unset(_ string)        {}
+
+func (c *FrozenCache) Files() map[string]*File {
+	files := make(map[string]*File, len(c.data))
+	for k, f := range c.data {
+		files[k] = f
+	}
+	return files
+}
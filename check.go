@@ -0,0 +1,146 @@
+package templatex
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Issue is the problem of the template found by Check
+type Issue struct {
+	Name    string
+	Line    int
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", i.Name, i.Line, i.Message)
+	}
+	return fmt.Sprintf("%s: %s", i.Name, i.Message)
+}
+
+// match "template: name:line: message" or "template: name:line:col: message"
+var reParseError = regexp.MustCompile(`^template: (.+?):(\d+):(?:\d+:)? (.+)$`)
+
+func parseErrorIssue(err error) (Issue, bool) {
+	m := reParseError.FindStringSubmatch(err.Error())
+	if m == nil {
+		return Issue{}, false
+	}
+	line, _ := strconv.Atoi(m[2])
+	return Issue{
+		Name:    m[1],
+		Line:    line,
+		Message: m[3],
+	}, true
+}
+
+// issueOf converts the error of preprocessing to the issue at the innermost
+// position that caused the error.
+func issueOf(name string, err error) Issue {
+	for {
+		pe, ok := err.(*PreprocessError)
+		if !ok {
+			break
+		} else if _, ok = pe.Err.(*PreprocessError); ok {
+			err = pe.Err
+			continue
+		} else if issue, ok := parseErrorIssue(pe.Err); ok {
+			return issue
+		}
+		return Issue{
+			Name:    pe.Name,
+			Line:    pe.Line,
+			Message: fmt.Sprintf("{{%s %q}}: %v", pe.Action, pe.Value, pe.Err),
+		}
+	}
+
+	if issue, ok := parseErrorIssue(err); ok {
+		return issue
+	}
+	return Issue{
+		Name:    name,
+		Message: err.Error(),
+	}
+}
+
+// match the literal names of the include and component functions, e.g.
+// {{include "@name.html" .}} or {{component "@name.html" .}}
+var reIncludeName = regexp.MustCompile(`\b(?:include|component)\s+"(@[^"]+)"`)
+
+// includedNames returns the names of the templates that are included by the
+// literal names in the text
+func includedNames(text string) []string {
+	var names []string
+	for _, m := range reIncludeName.FindAllStringSubmatch(text, -1) {
+		names = append(names, filepath.Clean(m[1]))
+	}
+	return names
+}
+
+func isPartial(pathname string) bool {
+	return strings.HasPrefix(filepath.Base(pathname), "@")
+}
+
+// Check preprocesses all the files that returned by ListFunc and matched to
+// the patterns, and returns the issues of them. the current template set is
+// not affected. in addition to the errors of preprocessing, the partial
+// templates that prefixed with "@" but not used by any templates are reported.
+// the templates included by the include and component functions with the
+// literal names are treated as used, but the names chosen at execution time
+// cannot be detected since Check does not render the templates.
+func (rt *Runtime) Check(patterns ...string) ([]Issue, error) {
+	list, err := rt.listfn()
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []Issue
+	found := make(map[string]bool)
+	cache := NewMapCache().(*MapCache)
+	for _, pathname := range list {
+		if ok, err := matchPatterns(patterns, pathname); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		pathname = filepath.Clean(pathname)
+		_, err := rt.preprocess(newSession(rt.templateFor(pathname), cache), pathname)
+		if err != nil {
+			if issue := issueOf(pathname, err); !found[issue.String()] {
+				found[issue.String()] = true
+				issues = append(issues, issue)
+			}
+		}
+	}
+
+	files := cache.Files()
+	included := make(map[string]bool)
+	for _, f := range files {
+		for _, name := range includedNames(f.text) {
+			included[name] = true
+		}
+	}
+	for name, f := range files {
+		if isPartial(name) && len(f.parents()) == 0 && !included[name] {
+			issues = append(issues, Issue{
+				Name:    name,
+				Message: "partial template is not used by any templates",
+			})
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		a, b := issues[i], issues[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Line < b.Line
+	})
+	return issues, nil
+}
@@ -0,0 +1,101 @@
+package templatex
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/mah0x211/templatex/builtins"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntime_Check(t *testing.T) {
+	// setup
+	rootdir := "/root/dir/"
+	files := map[string]string{
+		"/root/dir/@layout.html":  `[{{template "content" .}}]`,
+		"/root/dir/@include.html": `{{define "@include.html"}}included{{end}}`,
+		"/root/dir/@unused.html":  `{{define "@unused.html"}}unused{{end}}`,
+		"/root/dir/@invalid.html": "{{define \"@invalid.html\"}}\n{{UnknownFunc .}}\n{{end}}",
+		"/root/dir/@recursive.html": `{{define "@recursive.html"}}
+			{{template "@recursive.html" .}}
+		{{end}}`,
+		"/root/dir/index.html": `{{define "content"}}{{template "@include.html"}}{{end}}{{layout "@layout.html"}}`,
+		"/root/dir/missing.html": `hello
+			{{template "@missing.html" .}}`,
+		"/root/dir/two_layout.html": `{{layout "@layout.html"}}
+			{{layout "@layout.html"}}`,
+		"/root/dir/parse_error.html": "hello\n{{end}}",
+		"/root/dir/use_invalid.html": `{{template "@invalid.html"}}`,
+		"/root/dir/use_recursive.html": `
+			{{template "@recursive.html"}}`,
+		"/root/dir/data.json": `{}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[filepath.Join(rootdir, pathname)]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	cache := NewMapCache()
+	rt := NewEx(readfn, cache, builtins.FuncMap())
+	rt.SetListFunc(func() ([]string, error) {
+		var list []string
+		for pathname := range files {
+			list = append(list, strings.TrimPrefix(pathname, rootdir))
+		}
+		sort.Strings(list)
+		return list, nil
+	})
+
+	// test that returns the issues of the templates
+	issues, err := rt.Check("*.html")
+	assert.NoError(t, err)
+	var list []string
+	for _, issue := range issues {
+		list = append(list, issue.String())
+	}
+	assert.Equal(t, []string{
+		`@invalid.html:2: function "UnknownFunc" not defined`,
+		`@recursive.html:2: {{template "@recursive.html"}}: cannot parse "@recursive.html" recursively: @recursive.html -> @recursive.html`,
+		`@unused.html: partial template is not used by any templates`,
+		`missing.html:2: {{template "@missing.html"}}: no such file or directory`,
+		`parse_error.html:2: unexpected {{end}}`,
+		`two_layout.html:2: {{layout "@layout.html"}}: 'layout' action cannot be performed twice`,
+	}, list)
+	assert.Equal(t, Issue{Name: "parse_error.html", Line: 2, Message: "unexpected {{end}}"}, issues[4])
+
+	// test that the current template set is not affected
+	assert.Nil(t, cache.Get("index.html"))
+
+	// test that returns no issues
+	issues, err = rt.Check("index.html", "@layout.html", "@include.html")
+	assert.NoError(t, err)
+	assert.Empty(t, issues)
+
+	// test that the partials included by the literal names are used
+	files["/root/dir/@w.html"] = `widget`
+	files["/root/dir/@c.html"] = `<b>{{.Slot}}</b>`
+	files["/root/dir/@dynamic.html"] = `dynamic`
+	files["/root/dir/widgets.html"] = `{{include "@w.html" .}}
+		{{- component "@c.html"}}content{{end}}
+		{{- include (print "@dyn" "amic.html") .}}`
+	issues, err = rt.Check("widgets.html", "@w.html", "@c.html", "@dynamic.html")
+	assert.NoError(t, err)
+	assert.Equal(t, []Issue{
+		{Name: "@dynamic.html", Message: "partial template is not used by any templates"},
+	}, issues)
+
+	// test that returns an error if the pattern is invalid
+	_, err = rt.Check("[")
+	assert.Regexp(t, `invalid pattern "\["`, err)
+
+	// test that returns an error of ListFunc
+	rt.SetListFunc(func() ([]string, error) {
+		return nil, syscall.EACCES
+	})
+	_, err = rt.Check()
+	assert.Equal(t, syscall.EACCES, err)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mah0x211/templatex"
+	"github.com/mah0x211/templatex/builtins"
+)
+
+// sameDir reports whether the pathnames resolve to the same directory
+func sameDir(a, b string) bool {
+	if sa, err := os.Stat(a); err == nil {
+		if sb, err := os.Stat(b); err == nil {
+			return os.SameFile(sa, sb)
+		}
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+func cmdBuild(e *env, args []string) int {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(e.stderr, "usage: templatex build [options] [pattern ...]")
+		fmt.Fprintln(e.stderr)
+		fmt.Fprintf(e.stderr, "default patterns of the pages are %q\n\n", templatex.DefaultPagePatterns)
+		fs.PrintDefaults()
+	}
+	src := fs.String("src", ".", "source directory of the templates and static files")
+	out := fs.String("out", "", "output directory")
+	verbose := fs.Bool("v", false, "print the pathnames of the processed files")
+	frontMatter := fs.Bool("front-matter", false, `parse the front matter enclosed by "---" lines at the beginning of the templates`)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	} else if *out == "" {
+		fs.Usage()
+		return 2
+	} else if sameDir(*src, *out) {
+		// the outputs would overwrite the sources
+		fmt.Fprintf(e.stderr, "templatex: output directory %q must not be the source directory\n", *out)
+		return 2
+	}
+
+	rt := templatex.NewEx(templatex.DirReadFunc(*src), templatex.NewNopCache(), builtins.FuncMap())
+	rt.SetListFunc(templatex.DirListFunc(*src))
+	rt.SetFrontMatter(*frontMatter)
+	report, err := rt.BuildSite(*out, fs.Args()...)
+	if report != nil {
+		if *verbose {
+			for _, list := range []struct {
+				label string
+				names []string
+			}{
+				{"render", report.Rendered},
+				{"copy", report.Copied},
+				{"skip", report.Skipped},
+			} {
+				for _, name := range list.names {
+					fmt.Fprintf(e.stdout, "%s %s\n", list.label, name)
+				}
+			}
+		}
+		fmt.Fprintf(e.stdout, "%d rendered, %d copied, %d skipped\n", len(report.Rendered), len(report.Copied), len(report.Skipped))
+	}
+	if err != nil {
+		fmt.Fprintf(e.stderr, "templatex: %v\n", err)
+		return 1
+	}
+	return 0
+}
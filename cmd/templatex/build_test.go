@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mah0x211/templatex"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCmdBuild(t *testing.T) {
+	srcdir := setupFiles(t, map[string]string{
+		"@layout.html":  `<body>{{template "content" .}}</body>`,
+		"index.html":    `{{define "content"}}{{.Title}}{{end}}{{layout "@layout.html"}}`,
+		"index.json":    `{"Title": "hello"}`,
+		"css/style.css": `body {}`,
+	})
+	defer os.RemoveAll(srcdir)
+	outdir, err := ioutil.TempDir("", "templatex")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outdir)
+
+	// test that build the site
+	e := newTestEnv("")
+	assert.Equal(t, 0, run(&e.env, []string{"build", "-src", srcdir, "-out", outdir, "-v"}))
+	assert.Equal(t, "render index.html\ncopy css/style.css\n1 rendered, 1 copied, 0 skipped\n", e.stdout.String())
+	b, err := ioutil.ReadFile(filepath.Join(outdir, "index.html"))
+	assert.NoError(t, err)
+	assert.Equal(t, "<body>hello</body>", string(b))
+
+	// test that skip the unchanged files
+	e = newTestEnv("")
+	assert.Equal(t, 0, run(&e.env, []string{"build", "-src", srcdir, "-out", outdir}))
+	assert.Equal(t, "0 rendered, 0 copied, 2 skipped\n", e.stdout.String())
+
+	// test that parse the front matter with -front-matter
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(srcdir, "page.html"), []byte("---\ntitle: page\nlayout: @layout.html\n---\n{{define \"content\"}}{{.Page.title}}{{end}}"), 0644))
+	e = newTestEnv("")
+	assert.Equal(t, 0, run(&e.env, []string{"build", "-src", srcdir, "-out", outdir, "-front-matter"}))
+	assert.Equal(t, "1 rendered, 0 copied, 2 skipped\n", e.stdout.String())
+	b, err = ioutil.ReadFile(filepath.Join(outdir, "page.html"))
+	assert.NoError(t, err)
+	assert.Equal(t, "<body>page</body>", string(b))
+
+	// test that returns 1 if failed to build
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(srcdir, "broken.html"), []byte(`{{template "@missing.html"}}`), 0644))
+	e = newTestEnv("")
+	assert.Equal(t, 1, run(&e.env, []string{"build", "-src", srcdir, "-out", outdir}))
+	assert.Contains(t, e.stderr.String(), `could not render "broken.html"`)
+
+	// test that returns 2 if the output directory is the source directory
+	for _, dir := range []string{srcdir, srcdir + "/", filepath.Join(srcdir, "css", "..")} {
+		e = newTestEnv("")
+		assert.Equal(t, 2, run(&e.env, []string{"build", "-src", srcdir, "-out", dir}))
+		assert.Contains(t, e.stderr.String(), "must not be the source directory")
+	}
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(srcdir))
+	e = newTestEnv("")
+	assert.Equal(t, 2, run(&e.env, []string{"build", "-out", "."}))
+	assert.NoError(t, os.Chdir(wd))
+	_, err = os.Stat(filepath.Join(srcdir, templatex.SiteManifest))
+	assert.True(t, os.IsNotExist(err))
+
+	// test that returns 2 if the output directory is not specified
+	e = newTestEnv("")
+	assert.Equal(t, 2, run(&e.env, []string{"build", "-src", srcdir}))
+	assert.Contains(t, e.stderr.String(), "usage: templatex build")
+}
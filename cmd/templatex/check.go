@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/mah0x211/templatex"
+	"github.com/mah0x211/templatex/builtins"
+)
+
+var defaultPatterns = []string{"*.html", "*.htm", "*.tmpl", "*.txt"}
+
+func cmdCheck(e *env, args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(e.stderr, "usage: templatex check [options] [pattern ...]")
+		fmt.Fprintln(e.stderr)
+		fmt.Fprintf(e.stderr, "default patterns are %q\n\n", defaultPatterns)
+		fs.PrintDefaults()
+	}
+	root := fs.String("root", ".", "root directory of the templates")
+	frontMatter := fs.Bool("front-matter", false, `parse the front matter enclosed by "---" lines at the beginning of the templates`)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	patterns := fs.Args()
+	if len(patterns) == 0 {
+		patterns = defaultPatterns
+	}
+
+	rt := templatex.NewEx(templatex.DirReadFunc(*root), templatex.NewNopCache(), builtins.FuncMap())
+	rt.SetListFunc(templatex.DirListFunc(*root))
+	rt.SetFrontMatter(*frontMatter)
+	issues, err := rt.Check(patterns...)
+	if err != nil {
+		fmt.Fprintf(e.stderr, "templatex: %v\n", err)
+		return 2
+	}
+
+	for _, issue := range issues {
+		fmt.Fprintln(e.stdout, issue)
+	}
+	if len(issues) > 0 {
+		return 1
+	}
+	return 0
+}
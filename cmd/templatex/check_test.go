@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCmdCheck(t *testing.T) {
+	rootdir := setupFiles(t, map[string]string{
+		"@layout.html":     `<p>{{template "content" .}}</p>`,
+		"@unused.html":     `{{define "@unused.html"}}{{end}}`,
+		"index.html":       `{{define "content"}}hello{{end}}{{layout "@layout.html"}}`,
+		"sub/missing.html": "\n{{template \"@missing.html\"}}",
+		"data.json":        `{}`,
+		"page.html":        "---\nlayout: \"@?layout.html\"\n---\n",
+	})
+	defer os.RemoveAll(rootdir)
+
+	// test that report the issues and returns 1
+	e := newTestEnv("")
+	assert.Equal(t, 1, run(&e.env, []string{"check", "-root", rootdir}))
+	assert.Regexp(t, `^@unused.html: partial template is not used by any templates
+sub/missing.html:2: {{template "@missing.html"}}: open .+: no such file or directory
+$`, e.stdout.String())
+
+	// test that returns 0 if no issues found
+	e = newTestEnv("")
+	assert.Equal(t, 0, run(&e.env, []string{"check", "-root", rootdir, "index.html", "@layout.html"}))
+	assert.Empty(t, e.stdout.String())
+
+	// test that check the layout of the front matter with -front-matter
+	e = newTestEnv("")
+	assert.Equal(t, 1, run(&e.env, []string{"check", "-root", rootdir, "-front-matter", "page.html"}))
+	assert.Equal(t, "page.html:1: {{layout \"@?layout.html\"}}: 'layout' action cannot be optional\n", e.stdout.String())
+
+	// test that returns 2 if the pattern is invalid
+	e = newTestEnv("")
+	assert.Equal(t, 2, run(&e.env, []string{"check", "-root", rootdir, "["}))
+	assert.Contains(t, e.stderr.String(), `invalid pattern "["`)
+
+	// test that returns 2 if the root directory does not exist
+	e = newTestEnv("")
+	assert.Equal(t, 2, run(&e.env, []string{"check", "-root", rootdir + "/unknown"}))
+	assert.Contains(t, e.stderr.String(), "no such file or directory")
+}
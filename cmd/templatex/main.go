@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	summary string
+	run     func(e *env, args []string) int
+}
+
+var commands = map[string]*command{
+	"build": {
+		summary: "render all the pages into a directory as a static site",
+		run:     cmdBuild,
+	},
+	"check": {
+		summary: "report the problems of the templates",
+		run:     cmdCheck,
+	},
+	"render": {
+		summary: "render a template to stdout or a file",
+		run:     cmdRender,
+	},
+	"serve": {
+		summary: "serve the templates with live reload for development",
+		run:     cmdServe,
+	},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: templatex <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-8s %s\n", name, commands[name].summary)
+	}
+}
+
+func run(e *env, args []string) int {
+	if len(args) == 0 {
+		usage(e.stderr)
+		return 2
+	}
+
+	switch name := args[0]; name {
+	case "help", "-h", "-help", "--help":
+		usage(e.stdout)
+		return 0
+	default:
+		cmd, ok := commands[name]
+		if !ok {
+			fmt.Fprintf(e.stderr, "templatex: unknown command %q\n", name)
+			usage(e.stderr)
+			return 2
+		}
+		return cmd.run(e, args[1:])
+	}
+}
+
+func main() {
+	os.Exit(run(&env{
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}, os.Args[1:]))
+}
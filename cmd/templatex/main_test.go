@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setupFiles creates the files into the temporary directory
+func setupFiles(t *testing.T, files map[string]string) string {
+	rootdir, err := ioutil.TempDir("", "templatex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for pathname, content := range files {
+		pathname = filepath.Join(rootdir, pathname)
+		if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+			t.Fatal(err)
+		} else if err = ioutil.WriteFile(pathname, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rootdir
+}
+
+type testEnv struct {
+	env
+	stdout *bytes.Buffer
+	stderr *bytes.Buffer
+}
+
+func newTestEnv(stdin string) *testEnv {
+	e := &testEnv{
+		stdout: bytes.NewBuffer(nil),
+		stderr: bytes.NewBuffer(nil),
+	}
+	e.env = env{
+		stdin:  strings.NewReader(stdin),
+		stdout: e.stdout,
+		stderr: e.stderr,
+	}
+	return e
+}
+
+func TestRun(t *testing.T) {
+	// test that show usage if no command specified
+	e := newTestEnv("")
+	assert.Equal(t, 2, run(&e.env, nil))
+	assert.Contains(t, e.stderr.String(), "usage: templatex <command>")
+	assert.Contains(t, e.stderr.String(), "render ")
+
+	// test that show usage to stdout
+	e = newTestEnv("")
+	assert.Equal(t, 0, run(&e.env, []string{"help"}))
+	assert.Contains(t, e.stdout.String(), "usage: templatex <command>")
+
+	// test that returns an error for unknown command
+	e = newTestEnv("")
+	assert.Equal(t, 2, run(&e.env, []string{"unknown"}))
+	assert.Contains(t, e.stderr.String(), `templatex: unknown command "unknown"`)
+}
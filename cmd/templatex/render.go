@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/mah0x211/templatex"
+	"github.com/mah0x211/templatex/builtins"
+)
+
+// readData reads the JSON object from the file. if pathname is "-", it reads
+// from r.
+func readData(r io.Reader, pathname string) (map[string]interface{}, error) {
+	if pathname == "" {
+		return nil, nil
+	}
+
+	var b []byte
+	var err error
+	if pathname == "-" {
+		b, err = ioutil.ReadAll(r)
+	} else {
+		b, err = ioutil.ReadFile(pathname)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data map[string]interface{}
+	if err = json.Unmarshal(b, &data); err != nil {
+		return nil, fmt.Errorf("could not decode %q: %v", pathname, err)
+	}
+	return data, nil
+}
+
+func renderMode(rt *templatex.Runtime, mode string) (func(io.Writer, string, map[string]interface{}, ...templatex.RenderOption) error, error) {
+	switch mode {
+	case "auto":
+		return rt.Render, nil
+	case "text":
+		return rt.RenderText, nil
+	case "html":
+		return rt.RenderHTML, nil
+	}
+	return nil, fmt.Errorf("invalid mode %q: must be auto, text or html", mode)
+}
+
+func cmdRender(e *env, args []string) int {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(e.stderr, "usage: templatex render [options] <template>")
+		fmt.Fprintln(e.stderr)
+		fs.PrintDefaults()
+	}
+	root := fs.String("root", ".", "root directory of the templates")
+	mode := fs.String("mode", "auto", "render mode: auto, text or html. auto selects html for .html and .htm files")
+	datafile := fs.String("data", "", `JSON file of the data to render. "-" reads from stdin`)
+	layout := fs.String("layout", "", "layout template to use instead of the layout declared in the template")
+	output := fs.String("o", "", "output file. default is stdout")
+	frontMatter := fs.Bool("front-matter", false, `parse the front matter enclosed by "---" lines at the beginning of the templates`)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	} else if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	rt := templatex.NewEx(templatex.DirReadFunc(*root), templatex.NewNopCache(), builtins.FuncMap())
+	rt.SetFrontMatter(*frontMatter)
+	render, err := renderMode(rt, *mode)
+	if err != nil {
+		fmt.Fprintf(e.stderr, "templatex: %v\n", err)
+		return 2
+	}
+	data, err := readData(e.stdin, *datafile)
+	if err != nil {
+		fmt.Fprintf(e.stderr, "templatex: %v\n", err)
+		return 1
+	}
+
+	// render into the buffer to avoid writing the broken output
+	b := bytes.NewBuffer(nil)
+	if err = render(b, fs.Arg(0), data, templatex.WithLayout(*layout)); err != nil {
+		fmt.Fprintf(e.stderr, "templatex: %v\n", err)
+		return 1
+	}
+
+	if *output == "" {
+		_, err = b.WriteTo(e.stdout)
+	} else {
+		err = ioutil.WriteFile(*output, b.Bytes(), 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(e.stderr, "templatex: %v\n", err)
+		return 1
+	}
+	return 0
+}
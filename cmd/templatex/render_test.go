@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCmdRender(t *testing.T) {
+	rootdir := setupFiles(t, map[string]string{
+		"@layout.html": `<p>{{template "content" .}}</p>`,
+		"@mobile.html": `<div>{{template "content" .}}</div>`,
+		"index.html":   `{{define "content"}}hello {{.World}}{{end}}{{layout "@layout.html"}}`,
+		"config.txt":   `name = {{.World}}{{range .Items}} {{.}}{{end}}`,
+		"invalid.html": `hello {{.World}`,
+		"data.json":    `{"World": "<world>", "Items": [1, 2]}`,
+		"invalid.json": `["not", "object"]`,
+		"page.html":    "---\ntitle: Page\nlayout: @layout.html\n---\n{{define \"content\"}}hello {{.Page.title}}{{end}}",
+	})
+	defer os.RemoveAll(rootdir)
+	datafile := filepath.Join(rootdir, "data.json")
+
+	// test that render the html template with the data file
+	e := newTestEnv("")
+	assert.Equal(t, 0, run(&e.env, []string{"render", "-root", rootdir, "-data", datafile, "index.html"}))
+	assert.Equal(t, "<p>hello &lt;world&gt;</p>", e.stdout.String())
+
+	// test that render the template as text with the data from stdin
+	e = newTestEnv(`{"World": "<stdin>"}`)
+	assert.Equal(t, 0, run(&e.env, []string{"render", "-root", rootdir, "-mode", "text", "-data", "-", "index.html"}))
+	assert.Equal(t, "<p>hello <stdin></p>", e.stdout.String())
+
+	// test that render the template with the specified layout
+	e = newTestEnv("")
+	assert.Equal(t, 0, run(&e.env, []string{"render", "-root", rootdir, "-data", datafile, "-layout", "@mobile.html", "index.html"}))
+	assert.Equal(t, "<div>hello &lt;world&gt;</div>", e.stdout.String())
+
+	// test that render the text template by extension
+	e = newTestEnv("")
+	assert.Equal(t, 0, run(&e.env, []string{"render", "-root", rootdir, "-data", datafile, "config.txt"}))
+	assert.Equal(t, "name = <world> 1 2", e.stdout.String())
+
+	// test that parse the front matter with -front-matter
+	e = newTestEnv("")
+	assert.Equal(t, 0, run(&e.env, []string{"render", "-root", rootdir, "-front-matter", "page.html"}))
+	assert.Equal(t, "<p>hello Page</p>", e.stdout.String())
+
+	// test that write the output to the file
+	e = newTestEnv("")
+	output := filepath.Join(rootdir, "out", "config")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(output), 0755))
+	assert.Equal(t, 0, run(&e.env, []string{"render", "-root", rootdir, "-data", datafile, "-o", output, "config.txt"}))
+	assert.Empty(t, e.stdout.String())
+	b, err := ioutil.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, "name = <world> 1 2", string(b))
+
+	// test that returns 1 if failed to render
+	e = newTestEnv("")
+	assert.Equal(t, 1, run(&e.env, []string{"render", "-root", rootdir, "invalid.html"}))
+	assert.Empty(t, e.stdout.String())
+	assert.Regexp(t, `templatex: template: invalid.html:1:`, e.stderr.String())
+
+	e = newTestEnv("")
+	assert.Equal(t, 1, run(&e.env, []string{"render", "-root", rootdir, "unknown.html"}))
+	assert.Contains(t, e.stderr.String(), "no such file or directory")
+
+	// test that returns 1 if the data is not a JSON object
+	e = newTestEnv("")
+	assert.Equal(t, 1, run(&e.env, []string{"render", "-root", rootdir, "-data", filepath.Join(rootdir, "invalid.json"), "index.html"}))
+	assert.Contains(t, e.stderr.String(), "invalid.json")
+
+	// test that returns 2 if the arguments are invalid
+	e = newTestEnv("")
+	assert.Equal(t, 2, run(&e.env, []string{"render", "-root", rootdir}))
+	assert.Contains(t, e.stderr.String(), "usage: templatex render")
+
+	e = newTestEnv("")
+	assert.Equal(t, 2, run(&e.env, []string{"render", "-mode", "xml", "index.html"}))
+	assert.Contains(t, e.stderr.String(), `invalid mode "xml"`)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mah0x211/templatex"
+	"github.com/mah0x211/templatex/builtins"
+)
+
+const eventsPath = "/_templatex/events"
+
+// reloadScript reloads the page when the server notifies the change of the
+// template or its dependencies.
+const reloadScript = `<script>(function(){
+var es = new EventSource(%q + "?path=" + encodeURIComponent(%s));
+es.onmessage = function(){ es.close(); location.reload(); };
+})();</script>`
+
+type fileStat struct {
+	size    int64
+	modTime time.Time
+}
+
+type client struct {
+	page string
+	ch   chan struct{}
+}
+
+type server struct {
+	root    string
+	datadir string
+	rt      *templatex.Runtime
+	mu      sync.Mutex
+	files   map[string]fileStat
+	clients map[*client]struct{}
+}
+
+func newServer(root, datadir string) *server {
+	rt := templatex.NewEx(templatex.DirReadFunc(root), templatex.NewMapCache(), builtins.FuncMap())
+	rt.SetListFunc(templatex.DirListFunc(root))
+	return &server{
+		root:    root,
+		datadir: datadir,
+		rt:      rt,
+		clients: make(map[*client]struct{}),
+	}
+}
+
+func isTemplate(pathname string) bool {
+	for _, pattern := range defaultPatterns {
+		if ok, _ := filepath.Match(pattern, filepath.Base(pathname)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve converts the URL path to the pathname of the file under the root.
+// it returns false if the path refers to the hidden or partial file.
+func resolve(urlpath string) (string, bool) {
+	name := path.Clean("/" + urlpath)
+	if strings.HasSuffix(urlpath, "/") {
+		name = path.Join(name, "index.html")
+	}
+	for _, seg := range strings.Split(name, "/") {
+		if strings.HasPrefix(seg, "@") || strings.HasPrefix(seg, ".") {
+			return "", false
+		}
+	}
+	return filepath.FromSlash(strings.TrimPrefix(name, "/")), true
+}
+
+// dataFile returns the pathname of the JSON fixture for the template
+func (s *server) dataFile(name string) string {
+	return filepath.Join(s.datadir, strings.TrimSuffix(name, filepath.Ext(name))+".json")
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == eventsPath {
+		s.serveEvents(w, r)
+		return
+	}
+
+	name, ok := resolve(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	} else if !isTemplate(name) {
+		http.ServeFile(w, r, filepath.Join(s.root, name))
+		return
+	}
+
+	data, err := readData(nil, s.dataFile(name))
+	if errors.Is(err, os.ErrNotExist) {
+		data, err = nil, nil
+	}
+
+	b := bytes.NewBuffer(nil)
+	if err == nil {
+		err = s.rt.Render(b, name, data)
+	}
+	status := http.StatusOK
+	ctype := "text/plain; charset=utf-8"
+	if ext := filepath.Ext(name); ext == ".html" || ext == ".htm" {
+		ctype = "text/html; charset=utf-8"
+	}
+	if err != nil {
+		status = http.StatusInternalServerError
+		// the errors of the included templates are wrapped by PreprocessError
+		var pe *templatex.PreprocessError
+		if errors.Is(err, os.ErrNotExist) && !errors.As(err, &pe) {
+			status = http.StatusNotFound
+		}
+		ctype = "text/html; charset=utf-8"
+		b.Reset()
+		s.rt.NewErrorOverlay(filepath.ToSlash(name), err).WriteHTML(b)
+	}
+	w.Header().Set("Content-Type", ctype)
+	if !strings.HasPrefix(ctype, "text/html") {
+		b.WriteTo(w)
+		return
+	}
+
+	// inject the script before the closing body tag
+	body := b.Bytes()
+	idx := bytes.LastIndex(bytes.ToLower(body), []byte("</body>"))
+	if idx == -1 {
+		idx = len(body)
+	}
+	w.WriteHeader(status)
+	w.Write(body[:idx])
+	s.writeReloadScript(w, name)
+	w.Write(body[idx:])
+}
+
+func (s *server) writeReloadScript(w http.ResponseWriter, name string) {
+	page, _ := json.Marshal(name)
+	fmt.Fprintf(w, reloadScript, eventsPath, page)
+}
+
+func (s *server) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	c := &client{
+		page: filepath.Clean(r.URL.Query().Get("path")),
+		ch:   make(chan struct{}, 1),
+	}
+	s.mu.Lock()
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-c.ch:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// scan detects the changed files under the root, uncaches them and notifies
+// the clients of the pages that depend on them.
+func (s *server) scan() error {
+	list, err := templatex.DirListFunc(s.root)()
+	if err != nil {
+		return err
+	}
+	files := make(map[string]fileStat, len(list))
+	for _, name := range list {
+		if info, err := os.Stat(filepath.Join(s.root, name)); err == nil {
+			files[name] = fileStat{size: info.Size(), modTime: info.ModTime()}
+		}
+	}
+
+	s.mu.Lock()
+	prev := s.files
+	s.files = files
+	s.mu.Unlock()
+	if prev == nil {
+		return nil
+	}
+
+	var changed []string
+	for name, stat := range files {
+		if old, ok := prev[name]; !ok || old != stat {
+			changed = append(changed, name)
+		}
+	}
+	for name := range prev {
+		if _, ok := files[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) > 0 {
+		s.notify(changed)
+	}
+	return nil
+}
+
+func (s *server) notify(changed []string) {
+	// the pages that are not cached have never been rendered successfully, so
+	// they may depend on any files
+	g, err := s.rt.Graph()
+	if err != nil {
+		return
+	}
+	cached := make(map[string]bool, len(g.Nodes))
+	for _, name := range g.Nodes {
+		cached[name] = true
+	}
+	affected := make(map[string]bool)
+	for _, name := range changed {
+		affected[name] = true
+		for _, dep := range g.Dependents(name) {
+			affected[dep] = true
+		}
+		s.rt.Uncache(name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		data, _ := filepath.Rel(s.root, s.dataFile(c.page))
+		if !cached[c.page] || affected[c.page] || affected[data] {
+			select {
+			case c.ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (s *server) watch(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			s.scan()
+		}
+	}
+}
+
+func cmdServe(e *env, args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(e.stderr, "usage: templatex serve [options]")
+		fmt.Fprintln(e.stderr)
+		fs.PrintDefaults()
+	}
+	root := fs.String("root", ".", "root directory of the templates")
+	datadir := fs.String("data", "", "directory of the JSON data files. the data of x.html is x.json. default is the root directory. the changes are detected only under the root directory")
+	addr := fs.String("addr", "127.0.0.1:8080", "address to listen on")
+	interval := fs.Duration("interval", 500*time.Millisecond, "interval to check the changes of the files")
+	frontMatter := fs.Bool("front-matter", false, `parse the front matter enclosed by "---" lines at the beginning of the templates`)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	} else if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	} else if *datadir == "" {
+		*datadir = *root
+	}
+
+	s := newServer(*root, *datadir)
+	s.rt.SetFrontMatter(*frontMatter)
+	if err := s.scan(); err != nil {
+		fmt.Fprintf(e.stderr, "templatex: %v\n", err)
+		return 1
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go s.watch(*interval, done)
+
+	fmt.Fprintf(e.stderr, "templatex: serving %s on http://%s/\n", *root, *addr)
+	if err := http.ListenAndServe(*addr, s); err != nil {
+		fmt.Fprintf(e.stderr, "templatex: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	for urlpath, want := range map[string]string{
+		"/":                 "index.html",
+		"/sub/":             "sub/index.html",
+		"/about.html":       "about.html",
+		"/../../etc/passwd": "etc/passwd",
+		"/css/style.css":    "css/style.css",
+	} {
+		name, ok := resolve(urlpath)
+		assert.True(t, ok)
+		assert.Equal(t, filepath.FromSlash(want), name)
+	}
+
+	// test that the partials and hidden files cannot be resolved
+	for _, urlpath := range []string{"/@layout.html", "/@errors/404.html", "/.git/config"} {
+		_, ok := resolve(urlpath)
+		assert.False(t, ok)
+	}
+}
+
+func TestServer(t *testing.T) {
+	rootdir := setupFiles(t, map[string]string{
+		"@layout.html":  `<html><body>{{template "content" .}}</body></html>`,
+		"@nav.html":     `{{define "@nav.html"}}nav{{end}}`,
+		"index.html":    `{{define "content"}}{{template "@nav.html"}} hello {{.World}}{{end}}{{layout "@layout.html"}}`,
+		"index.json":    `{"World": "<world>"}`,
+		"about.html":    `about`,
+		"mail.txt":      `hello {{.World}}`,
+		"invalid.html":  `{{template "@missing.html"}}`,
+		"css/style.css": `body {}`,
+	})
+	defer os.RemoveAll(rootdir)
+	s := newServer(rootdir, rootdir)
+	assert.NoError(t, s.scan())
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	get := func(urlpath string) (int, string, string) {
+		res, err := http.Get(ts.URL + urlpath)
+		assert.NoError(t, err)
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		assert.NoError(t, err)
+		return res.StatusCode, res.Header.Get("Content-Type"), string(b)
+	}
+
+	// test that render the index page with the fixture data and script
+	status, ctype, body := get("/")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "text/html; charset=utf-8", ctype)
+	assert.Regexp(t, `(?s)^<html><body>nav hello &lt;world&gt;<script>.+`+eventsPath+`.+"index.html".+</script></body></html>$`, body)
+
+	// test that render the page without the fixture data
+	_, _, body = get("/about.html")
+	assert.Regexp(t, `^about<script>`, body)
+
+	// test that text template is rendered without script
+	status, ctype, body = get("/mail.txt")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "text/plain; charset=utf-8", ctype)
+	assert.Equal(t, "hello <no value>", body)
+
+	// test that the static file is served as is
+	status, _, body = get("/css/style.css")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "body {}", body)
+
+	// test that the partial cannot be accessed
+	status, _, _ = get("/@layout.html")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// test that returns 404 with the reload script
+	status, _, body = get("/unknown.html")
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Regexp(t, `(?s)<pre>.+no such file or directory</pre>.+<script>`, body)
+
+	// test that returns 500 with the error
+	status, _, body = get("/invalid.html")
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Regexp(t, `(?s)<pre>could not preprocess {{template &#34;@missing.html&#34;}}.+</pre>.+<script>`, body)
+
+	// test that notify the clients of the pages that depend on the changed file
+	var streams []io.Closer
+	defer func() {
+		for _, c := range streams {
+			c.Close()
+		}
+	}()
+	subscribe := func(page string) <-chan string {
+		res, err := http.Get(ts.URL + eventsPath + "?path=" + page)
+		assert.NoError(t, err)
+		streams = append(streams, res.Body)
+		assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+		ch := make(chan string, 1)
+		go func() {
+			r := bufio.NewReader(res.Body)
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				} else if line != "\n" {
+					ch <- line
+				}
+			}
+		}()
+		return ch
+	}
+	receive := func(ch <-chan string) string {
+		select {
+		case v := <-ch:
+			return v
+		case <-time.After(200 * time.Millisecond):
+			return ""
+		}
+	}
+	touch := func(name string) {
+		future := time.Now().Add(time.Hour)
+		assert.NoError(t, os.Chtimes(filepath.Join(rootdir, name), future, future))
+	}
+	index := subscribe("index.html")
+	about := subscribe("about.html")
+	invalid := subscribe("invalid.html")
+	time.Sleep(50 * time.Millisecond)
+
+	touch("@nav.html")
+	assert.NoError(t, s.scan())
+	assert.Equal(t, "data: reload\n", receive(index))
+	assert.Equal(t, "", receive(about))
+	assert.Equal(t, "data: reload\n", receive(invalid))
+
+	// test that the changed template is rendered again
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(rootdir, "@nav.html"), []byte(`{{define "@nav.html"}}menu{{end}}`), 0644))
+	assert.NoError(t, s.scan())
+	assert.Equal(t, "data: reload\n", receive(index))
+	_, _, body = get("/")
+	assert.Regexp(t, `^<html><body>menu hello &lt;world&gt;<script>`, body)
+
+	// test that notify the client if the fixture data is changed
+	touch("index.json")
+	assert.NoError(t, s.scan())
+	assert.Equal(t, "data: reload\n", receive(index))
+	assert.Equal(t, "", receive(about))
+}
+
+func TestCmdServe(t *testing.T) {
+	// test that returns 2 if the arguments are invalid
+	e := newTestEnv("")
+	assert.Equal(t, 2, run(&e.env, []string{"serve", "foo"}))
+	assert.Contains(t, e.stderr.String(), "usage: templatex serve")
+
+	e = newTestEnv("")
+	assert.Equal(t, 2, run(&e.env, []string{"serve", "-front-matter", "foo"}))
+	assert.Contains(t, e.stderr.String(), "-front-matter")
+
+	// test that returns 1 if the root directory does not exist
+	e = newTestEnv("")
+	assert.Equal(t, 1, run(&e.env, []string{"serve", "-root", "/unknown/templatex"}))
+	assert.Contains(t, e.stderr.String(), "no such file or directory")
+}
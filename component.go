@@ -0,0 +1,100 @@
+package templatex
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// body is the body of the block action. it is rendered with the data at the
+// position of the action when needed.
+type body struct {
+	x      *execution
+	file   *File
+	inst   *instance
+	name   string
+	digest string
+	data   interface{}
+}
+
+func (b *body) render() (string, error) {
+	tmpl, ok := b.x.t.renderer.Lookup(b.inst.tmpl, b.name)
+	if !ok {
+		return "", fmt.Errorf("body template %q not found", b.name)
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := b.x.t.renderer.Execute(tmpl, buf, b.data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (x *execution) body(name, digest string, data interface{}) *body {
+	return &body{
+		x:      x,
+		file:   x.file,
+		inst:   x.inst,
+		name:   name,
+		digest: digest,
+		data:   data,
+	}
+}
+
+// lastBody removes the body from the end of args
+func lastBody(args []interface{}) (*body, []interface{}) {
+	if len(args) > 0 {
+		if b, ok := args[len(args)-1].(*body); ok {
+			return b, args[:len(args)-1]
+		}
+	}
+	return nil, args
+}
+
+// props returns the map of the key-value pairs
+func props(kv ...interface{}) (map[string]interface{}, error) {
+	if len(kv)%2 != 0 {
+		return nil, fmt.Errorf("props requires key-value pairs")
+	}
+	m := make(map[string]interface{}, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		k, ok := kv[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("props key must be string, not %T", kv[i])
+		}
+		m[k] = kv[i+1]
+	}
+	return m, nil
+}
+
+// component renders the component template of name with the props and the
+// rendered body as .Slot. the body is rendered as the separate template with
+// the dot at the action, so the variables declared outside of the body are not
+// available in the body.
+//
+//	{{component "@button.html" (props "label" "Save")}}<i>icon</i>{{end}}
+func (x *execution) component(name string, args ...interface{}) (interface{}, error) {
+	b, args := lastBody(args)
+	if b == nil {
+		return nil, fmt.Errorf("component %q must be used as {{component name [props]}}...{{end}}", name)
+	} else if len(args) > 1 {
+		return nil, fmt.Errorf("component %q: too many arguments", name)
+	}
+
+	var p map[string]interface{}
+	if len(args) == 1 && args[0] != nil {
+		var ok bool
+		if p, ok = args[0].(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("component %q: props must be map[string]interface{}, not %T", name, args[0])
+		}
+	}
+
+	slot, err := b.render()
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]interface{}, len(p)+1)
+	for k, v := range p {
+		data[k] = v
+	}
+	data["Slot"] = x.t.renderer.Raw(slot)
+	return x.include(name, data)
+}
@@ -0,0 +1,109 @@
+package templatex
+
+import (
+	"bytes"
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/mah0x211/templatex/builtins"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProps(t *testing.T) {
+	// test that returns the map of the key-value pairs
+	p, err := props("label", "Save", "count", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"label": "Save", "count": 1}, p)
+
+	// test that returns an error if the arguments are not pairs
+	_, err = props("label")
+	assert.Error(t, err)
+
+	// test that returns an error if the key is not string
+	_, err = props(1, "Save")
+	assert.Error(t, err)
+}
+
+func TestMarkBlockActions(t *testing.T) {
+	f := &File{name: "index.html"}
+
+	// test that insert the block after the block actions
+	assert.Equal(t,
+		`{{component "@a.html"}}{{block "body:index.html#1" .}}a{{end}}`+"\n"+
+			`{{- component "@b.html" (props "x" "}}")}}{{block "body:index.html#2" . -}} b {{end}}`,
+		markBlockActions(f, `{{component "@a.html"}}a{{end}}`+"\n"+
+			`{{- component "@b.html" (props "x" "}}") -}} b {{end}}`),
+	)
+
+	// test that the other actions are not changed
+	text := `{{template "@a.html"}}{{componentx}}{{/* component */}}`
+	assert.Equal(t, text, markBlockActions(f, text))
+}
+
+func TestRuntime_Component(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@button.html": `<button class="{{.kind}}">{{.label}}{{.Slot}}</button>`,
+		"@card.html":   `{{define "@card.html"}}<div>{{.title}}: {{.Slot}}</div>{{end}}`,
+		"index.html": `{{range .Items -}}
+{{component "@card.html" (props "title" .Title) -}}
+<p>{{.Body}}</p>{{component "@button.html" (props "label" "<Save>" "kind" .Kind)}}<i>{{.Title}}</i>{{end}}
+{{- end}}
+{{- end}}`,
+		"noprops.html":  `{{component "@button.html"}}ok{{end}}`,
+		"invalid.html":  `{{component "@button.html" "label"}}ng{{end}}`,
+		"pipeline.html": `{{print (component "@button.html")}}`,
+		"missing.html":  `{{component "@unknown.html"}}ng{{end}}`,
+		"unclosed.html": `{{component "@button.html"}}ng`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	rt := NewEx(readfn, NewMapCache(), builtins.FuncMap())
+	data := map[string]interface{}{
+		"Items": []map[string]interface{}{
+			{"Title": "<a>", "Body": "<b>", "Kind": "primary"},
+			{"Title": "c", "Body": "d", "Kind": "primary"},
+		},
+	}
+
+	// test that render the components with the props and the slots
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt.RenderHTML(b, "index.html", data))
+	assert.Equal(t, `<div>&lt;a&gt;: <p>&lt;b&gt;</p><button class="primary">&lt;Save&gt;<i>&lt;a&gt;</i></button></div>`+
+		`<div>c: <p>d</p><button class="primary">&lt;Save&gt;<i>c</i></button></div>`, b.String())
+
+	// test that render the components with text/template
+	b.Reset()
+	assert.NoError(t, rt.RenderText(b, "index.html", data))
+	assert.Equal(t, `<div><a>: <p><b></p><button class="primary"><Save><i><a></i></button></div>`+
+		`<div>c: <p>d</p><button class="primary"><Save><i>c</i></button></div>`, b.String())
+
+	// test that render the component without props
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "noprops.html", nil))
+	assert.Equal(t, `<button class="">ok</button>`, b.String())
+
+	// test that returns an error if the props is not map
+	err := rt.RenderHTML(bytes.NewBuffer(nil), "invalid.html", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `component "@button.html": props must be map[string]interface{}, not string`)
+
+	// test that returns an error if the component is used without the body
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "pipeline.html", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `component "@button.html" must be used as {{component name [props]}}...{{end}}`)
+
+	// test that returns an error if the component does not exist
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "missing.html", nil)
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+
+	// test that returns an error if the component is not closed
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "unclosed.html", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected EOF")
+}
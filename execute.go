@@ -0,0 +1,97 @@
+package templatex
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mah0x211/templatex/builtins"
+)
+
+// unboundFunc returns the placeholder of the function that is bound to each
+// render. the placeholders are used to parse the templates.
+func unboundFunc(name string) func(...interface{}) (string, error) {
+	return func(...interface{}) (string, error) {
+		return "", fmt.Errorf("%s cannot be called outside of the rendering", name)
+	}
+}
+
+// instance is the copy of the template set of the file to execute. the parse
+// trees are also copied so that the escaping of html/template does not modify
+// the trees shared with the other instances.
+type instance struct {
+	tmpl interface{}
+	root interface{}
+}
+
+func (t *Template) newInstance(f *File) (*instance, error) {
+	tmpl, err := t.renderer.Clone(f.tmpl)
+	if err != nil {
+		return nil, err
+	}
+	for name, tree := range t.renderer.Trees(tmpl) {
+		if err = t.renderer.AddTree(tmpl, name, tree.Copy()); err != nil {
+			return nil, err
+		}
+	}
+	root, ok := t.renderer.Lookup(tmpl, f.rootName())
+	if !ok {
+		return nil, fmt.Errorf("template %q not found in %q", f.rootName(), f.name)
+	}
+	return &instance{
+		tmpl: tmpl,
+		root: root,
+	}, nil
+}
+
+// execution holds the states of a single render that are shared with the
+// functions bound to the templates
+type execution struct {
+	t     *Template
+	s     *session
+	depth int
+	// file and its instance being executed
+	file *File
+	inst *instance
+	// contents of the stacks and the stacks emitted
+	stacks  map[string]*stack
+	markers map[string]bool
+	// key-value store of the render
+	store *builtins.Scratch
+	// records of the stacks of the bodies of {{cache}} being rendered
+	records []*stackRecord
+}
+
+func (x *execution) funcs() map[string]interface{} {
+	return map[string]interface{}{
+		"include":   x.include,
+		"component": x.component,
+		"body":      x.body,
+		"push":      x.push,
+		"stack":     x.stack,
+		"set":       x.set,
+		"get":       x.get,
+		"incr":      x.incr,
+		"append":    x.append,
+		"cache":     x.cache,
+	}
+}
+
+func (x *execution) execute(f *File, w io.Writer, data interface{}) error {
+	inst, _ := f.pool.Get().(*instance)
+	if inst == nil {
+		var err error
+		if inst, err = x.t.newInstance(f); err != nil {
+			return err
+		}
+	}
+	x.t.renderer.Funcs(inst.tmpl, x.funcs())
+
+	prevFile, prev := x.file, x.inst
+	x.file, x.inst = f, inst
+	defer func() { x.file, x.inst = prevFile, prev }()
+	if err := x.t.renderer.Execute(inst.root, w, data); err != nil {
+		return err
+	}
+	f.pool.Put(inst)
+	return nil
+}
@@ -0,0 +1,218 @@
+package templatex
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FragmentStore stores the rendered output of the fragments enclosed by
+// {{cache}}. the value that is set with the ttl must be expired after the ttl
+// has passed, and the ttl 0 means the value never expires. Delete is called
+// when the templates that the value depends on are uncached.
+type FragmentStore interface {
+	Get(key string) (string, bool)
+	Set(key, value string, ttl time.Duration)
+	Delete(key string)
+}
+
+type fragment struct {
+	value   string
+	expires time.Time
+}
+
+// MemoryFragmentStore stores the fragments in the memory. the expired
+// fragments are deleted when they are read, and swept each time the number of
+// the fragments is doubled.
+type MemoryFragmentStore struct {
+	sync.RWMutex
+	data map[string]fragment
+	now  func() time.Time
+	// number of the fragments to sweep the expired ones at
+	sweepAt int
+}
+
+// minSweepFragments is the number of the fragments that the store holds
+// before sweeping the expired ones
+const minSweepFragments = 64
+
+func NewMemoryFragmentStore() *MemoryFragmentStore {
+	return &MemoryFragmentStore{
+		data: make(map[string]fragment),
+		now:  time.Now,
+	}
+}
+
+func (s *MemoryFragmentStore) Get(key string) (string, bool) {
+	s.RLock()
+	v, ok := s.data[key]
+	s.RUnlock()
+	if !ok {
+		return "", false
+	} else if !v.expires.IsZero() && !s.now().Before(v.expires) {
+		s.Lock()
+		if cur, ok := s.data[key]; ok && cur == v {
+			delete(s.data, key)
+		}
+		s.Unlock()
+		return "", false
+	}
+	return v.value, true
+}
+
+func (s *MemoryFragmentStore) Set(key, value string, ttl time.Duration) {
+	v := fragment{
+		value: value,
+	}
+	if ttl > 0 {
+		v.expires = s.now().Add(ttl)
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.data[key] = v
+	if n := len(s.data); n >= minSweepFragments && n >= s.sweepAt {
+		now := s.now()
+		for k, f := range s.data {
+			if !f.expires.IsZero() && !now.Before(f.expires) {
+				delete(s.data, k)
+			}
+		}
+		s.sweepAt = len(s.data) * 2
+	}
+}
+
+func (s *MemoryFragmentStore) Delete(key string) {
+	s.Lock()
+	delete(s.data, key)
+	s.Unlock()
+}
+
+// SetFragmentStore sets the store of the fragments. the fragments are not
+// cached if the store is not set.
+func (rt *Runtime) SetFragmentStore(store FragmentStore) {
+	rt.fragments = store
+}
+
+// fileDigest returns the digest of the template and its dependencies. it is
+// changed when the template or any of its dependencies is changed.
+func fileDigest(name, text string, layout *File, includes map[string]*File) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%s", name, len(text), text)
+	if layout != nil {
+		fmt.Fprintf(h, "\x00layout\x00%s", layout.digest)
+	}
+	names := make([]string, 0, len(includes))
+	for k := range includes {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(h, "\x00include\x00%s\x00%s", k, includes[k].digest)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// parseTTL converts v to the duration. the number is treated as seconds.
+func parseTTL(v interface{}) (time.Duration, error) {
+	switch v := v.(type) {
+	case time.Duration:
+		return v, nil
+	case int:
+		return time.Duration(v) * time.Second, nil
+	case int64:
+		return time.Duration(v) * time.Second, nil
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return time.Duration(n) * time.Second, nil
+		}
+		return time.ParseDuration(v)
+	}
+	return 0, fmt.Errorf("invalid ttl %v: must be duration, seconds or duration string", v)
+}
+
+// cache renders the body and stores the output in the fragment store with the
+// key and the ttl. the stored output is used until it is expired, or deleted
+// when the template that contains the body, its dependencies or the templates
+// included by the body at the execution time are uncached. without the cache
+// of the templates, nothing is uncached, so the outputs are only keyed by the
+// version of the template that contains the body and its dependencies, and
+// remain in the store until they are expired.
+// the stacks emitted and the contents pushed in the body are stored with the
+// output, and restored when the stored output is used.
+//
+//	{{cache (print "menu:" .User.Role) "10m"}}...{{end}}
+func (x *execution) cache(key interface{}, args ...interface{}) (interface{}, error) {
+	b, args := lastBody(args)
+	if b == nil {
+		return nil, fmt.Errorf("cache %v must be used as {{cache key [ttl]}}...{{end}}", key)
+	} else if len(args) > 1 {
+		return nil, fmt.Errorf("cache %v: too many arguments", key)
+	}
+
+	var ttl time.Duration
+	if len(args) == 1 {
+		var err error
+		if ttl, err = parseTTL(args[0]); err != nil {
+			return nil, fmt.Errorf("cache %v: %w", key, err)
+		}
+	}
+
+	store := x.t.fragments
+	if store == nil {
+		s, err := b.render()
+		if err != nil {
+			return nil, err
+		}
+		return x.t.renderer.Raw(s), nil
+	}
+
+	// the renderers make the different outputs from the same template
+	k := fmt.Sprintf("%T\x00%s\x00%s\x00%v", x.t.renderer, b.digest, b.name, key)
+	if v, ok := store.Get(k); ok {
+		if fv, ok := decodeFragment(v); ok {
+			x.restoreStacks(&fv.stackRecord)
+			return x.t.renderer.Raw(fv.Output), nil
+		}
+	}
+
+	fv := &fragmentValue{}
+	x.records = append(x.records, &fv.stackRecord)
+	s, err := b.render()
+	x.records = x.records[:len(x.records)-1]
+	if err != nil {
+		return nil, err
+	}
+	fv.Output = s
+	store.Set(k, fv.encode(), ttl)
+	// the templates included by the body are the dependencies of the file
+	if !b.file.addFragment(store, k) {
+		store.Delete(k)
+	}
+	return x.t.renderer.Raw(s), nil
+}
+
+// fragmentValue is the value of the fragment in the store
+type fragmentValue struct {
+	Output string `json:"output"`
+	stackRecord
+}
+
+func (v *fragmentValue) encode() string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func decodeFragment(s string) (*fragmentValue, bool) {
+	v := &fragmentValue{}
+	if err := json.Unmarshal([]byte(s), v); err != nil {
+		return nil, false
+	}
+	return v, true
+}
@@ -0,0 +1,189 @@
+package templatex
+
+import (
+	"bytes"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mah0x211/templatex/builtins"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryFragmentStore(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryFragmentStore()
+	s.now = func() time.Time { return now }
+
+	// test that returns the stored value
+	s.Set("foo", "bar", time.Minute)
+	s.Set("baz", "qux", 0)
+	v, ok := s.Get("foo")
+	assert.True(t, ok)
+	assert.Equal(t, "bar", v)
+
+	// test that returns false if the value does not exist
+	_, ok = s.Get("unknown")
+	assert.False(t, ok)
+
+	// test that returns false if the value is expired
+	now = now.Add(time.Minute)
+	_, ok = s.Get("foo")
+	assert.False(t, ok)
+	assert.NotContains(t, s.data, "foo")
+
+	// test that the value without ttl never expires
+	now = now.Add(time.Hour)
+	v, ok = s.Get("baz")
+	assert.True(t, ok)
+	assert.Equal(t, "qux", v)
+
+	// test that delete the value
+	s.Delete("baz")
+	_, ok = s.Get("baz")
+	assert.False(t, ok)
+
+	// test that sweep the expired values that are never read
+	for i := 0; i < minSweepFragments-1; i++ {
+		s.Set(fmt.Sprint("expired:", i), "v", time.Minute)
+	}
+	s.Set("forever", "v", 0)
+	now = now.Add(time.Minute)
+	for i := 0; i < minSweepFragments; i++ {
+		s.Set(fmt.Sprint("new:", i), "v", time.Minute)
+	}
+	assert.True(t, len(s.data) <= minSweepFragments+1)
+	assert.Contains(t, s.data, "forever")
+	assert.NotContains(t, s.data, "expired:0")
+}
+
+func TestParseTTL(t *testing.T) {
+	for _, c := range []struct {
+		v   interface{}
+		exp time.Duration
+	}{
+		{time.Second, time.Second},
+		{10, 10 * time.Second},
+		{int64(10), 10 * time.Second},
+		{1.5, 1500 * time.Millisecond},
+		{"10", 10 * time.Second},
+		{"5m", 5 * time.Minute},
+	} {
+		ttl, err := parseTTL(c.v)
+		assert.NoError(t, err)
+		assert.Equal(t, c.exp, ttl)
+	}
+
+	// test that returns an error if the ttl is invalid
+	for _, v := range []interface{}{"foo", nil, true} {
+		_, err := parseTTL(v)
+		assert.Error(t, err)
+	}
+}
+
+func TestRuntime_FragmentCache(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@menu.html":   `{{define "@menu.html"}}<nav>{{.Role}}:{{count}}</nav>{{end}}`,
+		"index.html":   `{{range .Roles}}{{cache (print "menu:" .Role) 60}}{{template "@menu.html" .}}{{end}}{{end}}`,
+		"index.txt":    `{{cache "menu"}}{{template "@menu.html" .}}{{end}}`,
+		"invalid.html": `{{cache "menu" "never"}}{{end}}`,
+		"@item.html":   `item:{{count}}`,
+		"dynamic.html": `{{cache "item"}}{{include .Item}}{{end}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	n := 0
+	funcs := builtins.FuncMap()
+	funcs["count"] = func() int {
+		n++
+		return n
+	}
+	rt := NewEx(readfn, NewMapCache(), funcs)
+	data := map[string]interface{}{
+		"Roles": []map[string]interface{}{
+			{"Role": "admin"},
+			{"Role": "<user>"},
+			{"Role": "admin"},
+		},
+	}
+	render := func(name string) string {
+		b := bytes.NewBuffer(nil)
+		assert.NoError(t, rt.Render(b, name, data))
+		return b.String()
+	}
+
+	// test that render the body every time without the store
+	assert.Equal(t, "<nav>admin:1</nav><nav>&lt;user&gt;:2</nav><nav>admin:3</nav>", render("index.html"))
+
+	// test that use the stored output for the same key
+	store := NewMemoryFragmentStore()
+	rt.SetFragmentStore(store)
+	assert.Equal(t, "<nav>admin:4</nav><nav>&lt;user&gt;:5</nav><nav>admin:4</nav>", render("index.html"))
+	assert.Equal(t, "<nav>admin:4</nav><nav>&lt;user&gt;:5</nav><nav>admin:4</nav>", render("index.html"))
+
+	// test that the outputs of the renderers are stored separately
+	data["Role"] = "<text>"
+	assert.Equal(t, "<nav><text>:6</nav>", render("index.txt"))
+	assert.Equal(t, "<nav><text>:6</nav>", render("index.txt"))
+
+	// test that the stored output is not used after the template that the
+	// body depends on is changed
+	files["@menu.html"] = `{{define "@menu.html"}}<ul>{{.Role}}:{{count}}</ul>{{end}}`
+	assert.NoError(t, rt.Uncache("@menu.html"))
+	assert.Equal(t, "<ul>admin:7</ul><ul>&lt;user&gt;:8</ul><ul>admin:7</ul>", render("index.html"))
+
+	// test that the outputs of the old template are deleted from the store
+	assert.Len(t, store.data, 2)
+	files["@menu.html"] = `{{define "@menu.html"}}<li>{{.Role}}{{end}}`
+	assert.NoError(t, rt.Uncache("@menu.html"))
+	assert.Len(t, store.data, 0)
+
+	// test that the stored output is not used after the template included by
+	// the body at the execution time is changed
+	data["Item"] = "@item.html"
+	assert.Equal(t, "item:9", render("dynamic.html"))
+	assert.Equal(t, "item:9", render("dynamic.html"))
+	files["@item.html"] = `ITEM:{{count}}`
+	assert.NoError(t, rt.Uncache("@item.html"))
+	assert.Equal(t, "ITEM:10", render("dynamic.html"))
+
+	// test that the stacks in the body are restored from the stored output
+	files["stack.html"] = `{{cache "page"}}<head>{{stack "scripts"}}</head>` +
+		`{{push "scripts" "a"}}<a>{{end}}{{push "scripts"}}<b>{{count}}{{end}}{{end}}` +
+		`{{push "scripts" "a"}}<dup>{{end}}{{push "scripts"}}<c>{{end}}`
+	assert.Equal(t, "<head><a><b>11<c></head>", render("stack.html"))
+	assert.Equal(t, "<head><a><b>11<c></head>", render("stack.html"))
+	assert.NotContains(t, render("stack.html"), "\x00")
+
+	// test that the contents pushed with the key already pushed are stored
+	files["pushed.html"] = `{{if .Pushed}}{{push "scripts" "a"}}<a>{{end}}{{end}}` +
+		`{{cache "pushed"}}{{push "scripts" "a"}}<a>{{end}}{{end}}{{stack "scripts"}}`
+	data["Pushed"] = true
+	assert.Equal(t, "<a>", render("pushed.html"))
+	data["Pushed"] = false
+	assert.Equal(t, "<a>", render("pushed.html"))
+
+	// test that the keys of the expired fragments are pruned from the file
+	now := time.Now()
+	store.now = func() time.Time { return now }
+	files["user.html"] = `{{cache .User "1m"}}{{.User}}{{end}}`
+	for i := 0; i < minPruneFragments*4; i++ {
+		data["User"] = fmt.Sprint("user", i)
+		assert.Equal(t, data["User"], render("user.html"))
+		now = now.Add(time.Second)
+	}
+	f := rt.Cache().Get("user.html")
+	assert.True(t, len(f.fragments) < minPruneFragments*2)
+	assert.True(t, len(store.data) < minSweepFragments*2)
+
+	// test that returns an error if the ttl is invalid
+	err := rt.RenderHTML(bytes.NewBuffer(nil), "invalid.html", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `cache menu: time: invalid duration "never"`)
+}
@@ -0,0 +1,125 @@
+package templatex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FrontMatter is the metadata at the beginning of the template file. it is
+// passed to the template as .Page.
+type FrontMatter map[string]interface{}
+
+// String returns the value of key as string
+func (fm FrontMatter) String(key string) string {
+	if v, ok := fm[key]; ok && v != nil {
+		if s, ok := v.(string); ok {
+			return s
+		}
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+func (fm FrontMatter) Layout() string {
+	return fm.String("layout")
+}
+
+var frontMatterDelim = []byte("---")
+
+// parseFrontMatter extracts the front matter from the beginning of the text.
+// the front matter is the JSON object or the "key: value" lines enclosed by
+// "---" lines. the front matter is replaced with the comment action to keep
+// the line numbers of the template.
+func parseFrontMatter(buf []byte) (FrontMatter, []byte, error) {
+	if !bytes.HasPrefix(buf, frontMatterDelim) || !isDelimLine(buf, 0) {
+		return nil, buf, nil
+	}
+
+	body, n, err := splitFrontMatter(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	var fm FrontMatter
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		if err = json.Unmarshal(body, &fm); err != nil {
+			return nil, nil, err
+		}
+	} else if fm, err = parseKeyValues(body); err != nil {
+		return nil, nil, err
+	}
+
+	// replace with the comment action that contains the same number of newlines
+	var b []byte
+	if nl := bytes.Count(buf[:n], []byte("\n")); nl > 0 {
+		b = append([]byte("{{/*"), bytes.Repeat([]byte("\n"), nl)...)
+		b = append(b, "*/}}"...)
+	}
+	return fm, append(b, buf[n:]...), nil
+}
+
+// isDelimLine returns true if the line at the offset is "---"
+func isDelimLine(buf []byte, offset int) bool {
+	line := buf[offset:]
+	if i := bytes.IndexByte(line, '\n'); i != -1 {
+		line = line[:i]
+	}
+	return string(bytes.TrimRight(line, " \t\r")) == string(frontMatterDelim)
+}
+
+// splitFrontMatter returns the lines enclosed by "---" lines and the number of
+// bytes consumed.
+func splitFrontMatter(buf []byte) ([]byte, int, error) {
+	head := bytes.IndexByte(buf, '\n') + 1
+	for n := head; head > 0 && n < len(buf); {
+		line := buf[n:]
+		if i := bytes.IndexByte(line, '\n'); i != -1 {
+			line = line[:i+1]
+		}
+		if isDelimLine(buf, n) {
+			return buf[head:n], n + len(line), nil
+		}
+		n += len(line)
+	}
+	return nil, 0, fmt.Errorf("front matter is not closed with %q", frontMatterDelim)
+}
+
+// parseKeyValues parses the "key: value" lines of the front matter
+func parseKeyValues(body []byte) (FrontMatter, error) {
+	fm := FrontMatter{}
+	// the first line is the delimiter
+	lineno := 1
+	for _, line := range strings.Split(string(body), "\n") {
+		lineno++
+		s := strings.TrimSpace(line)
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+
+		i := strings.IndexByte(s, ':')
+		if i == -1 {
+			return nil, fmt.Errorf("front matter line %d: %q is not a key: value pair", lineno, s)
+		}
+		fm[strings.TrimSpace(s[:i])] = parseValue(strings.TrimSpace(s[i+1:]))
+	}
+	return fm, nil
+}
+
+// parseValue converts the value to the list if it is enclosed by "[" and "]",
+// and unquotes the quoted string.
+func parseValue(v string) interface{} {
+	if strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]") {
+		list := []interface{}{}
+		for _, item := range strings.Split(v[1:len(v)-1], ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, parseValue(item))
+			}
+		}
+		return list
+	} else if s, err := strconv.Unquote(v); err == nil {
+		return s
+	}
+	return v
+}
@@ -0,0 +1,189 @@
+package templatex
+
+import (
+	"bytes"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/mah0x211/templatex/builtins"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseFrontMatter(t *testing.T) {
+	// test that returns the text as is if no front matter
+	for _, text := range []string{
+		"", "{", "{{.Title}}", "hello\n---\nfoo: bar\n---\n", "----\n",
+		`{"title": "Hello"}{{.Page.title}}`, "{\n  \"n\": {{.N}}\n}",
+	} {
+		fm, b, err := parseFrontMatter([]byte(text))
+		assert.NoError(t, err)
+		assert.Nil(t, fm)
+		assert.Equal(t, text, string(b))
+	}
+
+	// test that parse JSON front matter and keep the line numbers
+	fm, b, err := parseFrontMatter([]byte("---\n{\n  \"title\": \"Hello\",\n  \"tags\": [\"a\", \"b\"]\n}\n---\n{{.Page.title}}"))
+	assert.NoError(t, err)
+	assert.Equal(t, FrontMatter{
+		"title": "Hello",
+		"tags":  []interface{}{"a", "b"},
+	}, fm)
+	assert.Equal(t, "{{/*\n\n\n\n\n\n*/}}{{.Page.title}}", string(b))
+
+	// test that parse key: value front matter and keep the line numbers
+	fm, b, err = parseFrontMatter([]byte("---\r\ntitle: Hello: World\r\n# comment\r\n\r\nlayout: \"@layout.html\"\r\ntags: [a, \"b c\", ]\r\n---\r\n{{.Page.title}}"))
+	assert.NoError(t, err)
+	assert.Equal(t, FrontMatter{
+		"title":  "Hello: World",
+		"layout": "@layout.html",
+		"tags":   []interface{}{"a", "b c"},
+	}, fm)
+	assert.Equal(t, "{{/*\n\n\n\n\n\n\n*/}}{{.Page.title}}", string(b))
+	assert.Equal(t, "@layout.html", fm.Layout())
+	assert.Equal(t, "[a b c]", fm.String("tags"))
+	assert.Equal(t, "", fm.String("unknown"))
+
+	// test that returns an error if front matter is invalid
+	_, _, err = parseFrontMatter([]byte("---\n{\"title\": }\n---\n"))
+	assert.Error(t, err)
+	_, _, err = parseFrontMatter([]byte("---\ntitle\n---\n"))
+	assert.EqualError(t, err, `front matter line 2: "title" is not a key: value pair`)
+	_, _, err = parseFrontMatter([]byte("---\ntitle: foo\n"))
+	assert.EqualError(t, err, `front matter is not closed with "---"`)
+}
+
+func TestRuntime_FrontMatter(t *testing.T) {
+	// setup
+	rootdir := "/root/dir/"
+	files := map[string]string{
+		"/root/dir/@layout.html":  `<title>{{.Page.title}}</title>{{template "content" .}}`,
+		"/root/dir/@mobile.html":  `<h1>{{.Page.title}}</h1>{{template "content" .}}`,
+		"/root/dir/@include.html": "---\ntitle: include\n---\n{{define \"@include.html\"}}{{.Page.title}}{{end}}",
+		"/root/dir/index.html": `---
+{"title": "<Index>", "layout": "@layout.html", "tags": ["a", "b"]}
+---
+{{define "content"}}{{range .Page.tags}}[{{.}}]{{end}} {{template "@include.html" .}}{{end}}`,
+		"/root/dir/mobile.html":     "---\ntitle: Mobile\nlayout: @mobile.html\n---\n{{define \"content\"}}mobile{{end}}",
+		"/root/dir/plain.txt":       "---\ntitle: Plain\n---\n{{.Page.title}} {{.Name}}",
+		"/root/dir/has_page.txt":    "---\ntitle: Plain\n---\n{{.Page}}",
+		"/root/dir/two_layout.html": "---\nlayout: @layout.html\n---\n{{layout \"@layout.html\"}}",
+		"/root/dir/no_layout.html":  "---\nlayout: @unknown.html\n---\n",
+		"/root/dir/no_prefix.html":  "---\nlayout: layout.html\n---\n",
+		"/root/dir/optional.html":   "---\nlayout: \"@?unknown.html|@layout.html\"\n---\n",
+		"/root/dir/fallback.html":   "---\ntitle: Fallback\nlayout: \"@unknown.html|@mobile.html\"\n---\n{{define \"content\"}}fallback{{end}}",
+		"/root/dir/invalid.html":    "---\ntitle: foo\n",
+		"/root/dir/lineno.html":     "---\ntitle: foo\n---\n\n{{.Unknown}",
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[filepath.Join(rootdir, pathname)]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	rt := NewEx(readfn, NewMapCache(), builtins.FuncMap())
+	rt.SetFrontMatter(true)
+
+	// test that front matter is passed to the template as .Page
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt.RenderHTML(b, "index.html", nil))
+	assert.Equal(t, "<title>&lt;Index&gt;</title>[a][b] &lt;Index&gt;", b.String())
+
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "mobile.html", nil))
+	assert.Equal(t, "<h1>Mobile</h1>mobile", b.String())
+
+	b.Reset()
+	data := map[string]interface{}{"Name": "foo"}
+	assert.NoError(t, rt.RenderText(b, "plain.txt", data))
+	assert.Equal(t, "Plain foo", b.String())
+	assert.Equal(t, map[string]interface{}{"Name": "foo"}, data)
+
+	// test that .Page of the data is not overwritten
+	b.Reset()
+	assert.NoError(t, rt.RenderText(b, "has_page.txt", map[string]interface{}{"Page": "data"}))
+	assert.Equal(t, "data", b.String())
+
+	// test that the layout of front matter is tracked as dependency
+	g, err := rt.Graph()
+	assert.NoError(t, err)
+	assert.Contains(t, g.Edges, Edge{From: "mobile.html", To: "@mobile.html", Kind: EdgeLayout})
+
+	// test that returns the front matter
+	fm, err := rt.FrontMatter("mobile.html")
+	assert.NoError(t, err)
+	assert.Equal(t, FrontMatter{"title": "Mobile", "layout": "@mobile.html"}, fm)
+	assert.Equal(t, FrontMatter{"title": "Mobile", "layout": "@mobile.html"}, rt.Cache().Get("mobile.html").FrontMatter())
+	_, err = rt.FrontMatter("unknown.html")
+	assert.Equal(t, syscall.ENOENT, err)
+
+	// test that returns an error if layout is specified twice
+	err = rt.RenderHTML(b, "two_layout.html", nil)
+	assert.EqualError(t, err, `could not preprocess {{layout "@layout.html"}} in "two_layout.html": 'layout' action cannot be performed twice`)
+
+	// test that returns an error if layout does not exist
+	err = rt.RenderHTML(b, "no_layout.html", nil)
+	assert.Equal(t, &PreprocessError{Name: "no_layout.html", Line: 1, Action: "layout", Value: "@unknown.html", Err: syscall.ENOENT}, err)
+
+	// test that the layout is validated like the 'layout' action
+	err = rt.RenderHTML(b, "no_prefix.html", nil)
+	assert.EqualError(t, err, `could not preprocess {{layout "layout.html"}} in "no_prefix.html": invalid include name "layout.html": must be prefixed with "@"`)
+	err = rt.RenderHTML(b, "optional.html", nil)
+	assert.Equal(t, &PreprocessError{Name: "optional.html", Line: 1, Action: "layout", Value: "@?unknown.html|@layout.html", Err: ErrOptionalLayout}, err)
+
+	// test that the layout falls back to the next candidate
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "fallback.html", nil))
+	assert.Equal(t, "<h1>Fallback</h1>fallback", b.String())
+
+	// test that returns an error if front matter is invalid
+	err = rt.RenderHTML(b, "invalid.html", nil)
+	assert.EqualError(t, err, `invalid front matter in "invalid.html": front matter is not closed with "---"`)
+
+	// test that the line numbers are kept
+	err = rt.RenderHTML(b, "lineno.html", nil)
+	assert.Regexp(t, `^template: lineno.html:5:`, err)
+}
+
+func TestRuntime_FrontMatterDisabled(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"object.json":  `{"name": "{{.Name}}"}`,
+		"lines.json":   "{\n  \"n\": {{.N}}\n}",
+		"doc.yaml":     "---\nname: {{.Name}}\n---\nn: {{.N}}\n",
+		"unclosed.yml": "---\nname: {{.Name}}\n",
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	data := map[string]interface{}{"Name": "foo", "N": 1}
+
+	// test that the templates prefixed with "{" or "---" are rendered as is
+	rt := NewEx(readfn, NewMapCache(), builtins.FuncMap())
+	for name, exp := range map[string]string{
+		"object.json":  `{"name": "foo"}`,
+		"lines.json":   "{\n  \"n\": 1\n}",
+		"doc.yaml":     "---\nname: foo\n---\nn: 1\n",
+		"unclosed.yml": "---\nname: foo\n",
+	} {
+		b := bytes.NewBuffer(nil)
+		assert.NoError(t, rt.RenderText(b, name, data), name)
+		assert.Equal(t, exp, b.String(), name)
+	}
+
+	// test that the templates prefixed with "{" are rendered as is even if
+	// front matter is enabled
+	rt = NewEx(readfn, NewMapCache(), builtins.FuncMap())
+	rt.SetFrontMatter(true)
+	for name, exp := range map[string]string{
+		"object.json": `{"name": "foo"}`,
+		"lines.json":  "{\n  \"n\": 1\n}",
+	} {
+		b := bytes.NewBuffer(nil)
+		assert.NoError(t, rt.RenderText(b, name, data), name)
+		assert.Equal(t, exp, b.String(), name)
+	}
+}
@@ -0,0 +1,164 @@
+package templatex
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+type EdgeKind string
+
+const (
+	EdgeInclude EdgeKind = "include"
+	EdgeLayout  EdgeKind = "layout"
+)
+
+// Edge represents that the From template uses the To template
+type Edge struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Kind EdgeKind `json:"kind"`
+}
+
+type Graph struct {
+	Nodes []string `json:"nodes"`
+	Edges []Edge   `json:"edges"`
+}
+
+// NewGraph creates the dependency graph of the files and the files that
+// used by them.
+func NewGraph(files ...*File) *Graph {
+	g := &Graph{
+		Nodes: []string{},
+		Edges: []Edge{},
+	}
+	visited := make(map[string]bool)
+	nodes := make(map[string]bool)
+	edges := make(map[Edge]bool)
+	addEdge := func(e Edge) {
+		if !edges[e] {
+			edges[e] = true
+			g.Edges = append(g.Edges, e)
+		}
+	}
+	var walk func(f *File)
+	walk = func(f *File) {
+		if visited[f.key] {
+			return
+		}
+		visited[f.key] = true
+		if !nodes[f.name] {
+			nodes[f.name] = true
+			g.Nodes = append(g.Nodes, f.name)
+		}
+		if f.layout != nil {
+			addEdge(Edge{From: f.name, To: f.layout.name, Kind: EdgeLayout})
+			walk(f.layout)
+		}
+		for _, c := range f.children() {
+			addEdge(Edge{From: f.name, To: c.name, Kind: EdgeInclude})
+			walk(c)
+		}
+	}
+	for _, f := range files {
+		walk(f)
+	}
+
+	sort.Strings(g.Nodes)
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		} else if a.To != b.To {
+			return a.To < b.To
+		}
+		return a.Kind < b.Kind
+	})
+	return g
+}
+
+// Graph returns the dependency graph of the current template set
+func (rt *Runtime) Graph() (*Graph, error) {
+	cache := rt.Cache()
+	lister, ok := cache.(FileLister)
+	if !ok {
+		if _, ok = cache.(NopCache); ok {
+			return NewGraph(), nil
+		}
+		return nil, fmt.Errorf("%T cannot list its files", cache)
+	}
+
+	files := lister.Files()
+	list := make([]*File, 0, len(files))
+	for _, f := range files {
+		list = append(list, f)
+	}
+	return NewGraph(list...), nil
+}
+
+// traverse returns the names of the nodes that reachable from the named node.
+// if reverse is true, it follows the edges in the reverse direction.
+func (g *Graph) traverse(name string, reverse bool) []string {
+	list := []string{}
+	visited := map[string]bool{name: true}
+	queue := []string{name}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, e := range g.Edges {
+			from, to := e.From, e.To
+			if reverse {
+				from, to = to, from
+			}
+			if from == cur && !visited[to] {
+				visited[to] = true
+				list = append(list, to)
+				queue = append(queue, to)
+			}
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Dependencies returns the names of the templates that used by the named
+// template directly or indirectly.
+func (g *Graph) Dependencies(name string) []string {
+	return g.traverse(name, false)
+}
+
+// Dependents returns the names of the templates that use the named template
+// directly or indirectly. they will be affected by the change of the template.
+func (g *Graph) Dependents(name string) []string {
+	return g.traverse(name, true)
+}
+
+func (g *Graph) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language
+func (g *Graph) WriteDOT(w io.Writer) error {
+	if _, err := io.WriteString(w, "digraph templates {\n"); err != nil {
+		return err
+	}
+	for _, n := range g.Nodes {
+		if _, err := fmt.Fprintf(w, "\t%q;\n", n); err != nil {
+			return err
+		}
+	}
+	for _, e := range g.Edges {
+		style := "solid"
+		if e.Kind == EdgeLayout {
+			style = "dashed"
+		}
+		if _, err := fmt.Fprintf(w, "\t%q -> %q [label=%q, style=%s];\n", e.From, e.To, e.Kind, style); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "}\n")
+	return err
+}
@@ -0,0 +1,111 @@
+package templatex
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/mah0x211/templatex/builtins"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntime_Graph(t *testing.T) {
+	// setup
+	rootdir := "/root/dir/"
+	files := map[string]string{
+		"/root/dir/@footer.html": `{{define "@footer.html"}}footer{{end}}`,
+		"/root/dir/@nav.html":    `{{define "@nav.html"}}nav{{end}}`,
+		"/root/dir/@layout.html": `{{template "content" .}}{{template "@footer.html"}}`,
+		"/root/dir/index.html":   `{{define "content"}}{{template "@nav.html"}}{{end}}{{layout "@layout.html"}}`,
+		"/root/dir/about.html":   `{{define "content"}}about{{end}}{{layout "@layout.html"}}`,
+		"/root/dir/plain.html":   `{{template "@nav.html"}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[filepath.Join(rootdir, pathname)]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	rt := NewEx(readfn, NewMapCache(), builtins.FuncMap())
+	rt.SetListFunc(func() ([]string, error) {
+		return []string{"index.html", "about.html", "plain.html"}, nil
+	})
+	assert.NoError(t, rt.Preload())
+
+	// test that returns the graph of the current template set
+	g, err := rt.Graph()
+	assert.NoError(t, err)
+	assert.Equal(t, &Graph{
+		Nodes: []string{"@footer.html", "@layout.html", "@nav.html", "about.html", "index.html", "plain.html"},
+		Edges: []Edge{
+			{From: "@layout.html", To: "@footer.html", Kind: EdgeInclude},
+			{From: "about.html", To: "@layout.html", Kind: EdgeLayout},
+			{From: "index.html", To: "@layout.html", Kind: EdgeLayout},
+			{From: "index.html", To: "@nav.html", Kind: EdgeInclude},
+			{From: "plain.html", To: "@nav.html", Kind: EdgeInclude},
+		},
+	}, g)
+
+	// test that returns the dependencies and dependents
+	assert.Equal(t, []string{"@footer.html", "@layout.html", "@nav.html"}, g.Dependencies("index.html"))
+	assert.Equal(t, []string{}, g.Dependencies("@nav.html"))
+	assert.Equal(t, []string{"@layout.html", "about.html", "index.html"}, g.Dependents("@footer.html"))
+	assert.Equal(t, []string{"index.html", "plain.html"}, g.Dependents("@nav.html"))
+
+	// test that the graph contains the templates loaded by the include and
+	// component functions after the render
+	files["/root/dir/@btn.html"] = `button`
+	files["/root/dir/@card.html"] = `[{{.Slot}}]`
+	files["/root/dir/widgets.html"] = `{{include "@btn.html" .}}{{component "@card.html"}}card{{end}}`
+	err = rt.Render(bytes.NewBuffer(nil), "widgets.html", nil)
+	assert.NoError(t, err)
+	g, err = rt.Graph()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"@btn.html", "@card.html"}, g.Dependencies("widgets.html"))
+	assert.Equal(t, []string{"widgets.html"}, g.Dependents("@btn.html"))
+	assert.Equal(t, []string{"widgets.html"}, g.Dependents("@card.html"))
+
+	// test that the graph of a file contains its dependencies only
+	assert.Equal(t, &Graph{
+		Nodes: []string{"@nav.html", "plain.html"},
+		Edges: []Edge{
+			{From: "plain.html", To: "@nav.html", Kind: EdgeInclude},
+		},
+	}, NewGraph(rt.Cache().Get("plain.html")))
+
+	// test that write the graph as JSON
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, NewGraph(rt.Cache().Get("about.html")).WriteJSON(b))
+	v := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &v))
+	assert.Equal(t, map[string]interface{}{
+		"nodes": []interface{}{"@footer.html", "@layout.html", "about.html"},
+		"edges": []interface{}{
+			map[string]interface{}{"from": "@layout.html", "to": "@footer.html", "kind": "include"},
+			map[string]interface{}{"from": "about.html", "to": "@layout.html", "kind": "layout"},
+		},
+	}, v)
+
+	// test that write the graph as DOT
+	b.Reset()
+	assert.NoError(t, NewGraph(rt.Cache().Get("about.html")).WriteDOT(b))
+	assert.Equal(t, `digraph templates {
+	"@footer.html";
+	"@layout.html";
+	"about.html";
+	"@layout.html" -> "@footer.html" [label="include", style=solid];
+	"about.html" -> "@layout.html" [label="layout", style=dashed];
+}
+`, b.String())
+
+	// test that returns an empty graph with NopCache
+	g, err = NewEx(readfn, NewNopCache(), nil).Graph()
+	assert.NoError(t, err)
+	assert.Equal(t, &Graph{Nodes: []string{}, Edges: []Edge{}}, g)
+
+	// test that returns an error if the cache cannot list its files
+	_, err = NewEx(readfn, testCache{}, nil).Graph()
+	assert.Regexp(t, `templatex.testCache cannot list its files`, err)
+}
@@ -0,0 +1,190 @@
+package templatex
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DataFunc returns the data to render the template of pathname for the request
+type DataFunc func(r *http.Request, pathname string) (map[string]interface{}, error)
+
+type HandlerOptions struct {
+	// Data provides the data for each request. the template is rendered with
+	// nil data if it is not set.
+	Data DataFunc
+	// Index is the name of the template that is rendered for the directory.
+	// default is "index.html".
+	Index string
+	// Extensions are appended in order to the path that has no extension to
+	// find the template. default is [".html"]. only the paths that have these
+	// extensions or the html extensions can be requested.
+	Extensions []string
+	// ErrorPages maps the status codes to the templates that render the error
+	// pages, e.g. {404: "@errors/404.html", 500: "@errors/500.html"}. the
+	// error page is written in plain text if it is not set or it fails.
+	ErrorPages map[int]string
+	// Dev writes the error overlay instead of the error page if the html
+	// template fails to render.
+	Dev bool
+}
+
+type handler struct {
+	rt   *Runtime
+	opts HandlerOptions
+	// extensions of the templates that can be requested
+	exts map[string]bool
+}
+
+// Handler returns the http.Handler that renders the templates mapped from the
+// request paths. the templates prefixed with "@" or "." cannot be requested.
+// the templates that have the html extension are rendered with html/template,
+// and the others are rendered with text/template.
+func Handler(rt *Runtime, opts *HandlerOptions) http.Handler {
+	h := &handler{
+		rt: rt,
+	}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.Index == "" {
+		h.opts.Index = "index.html"
+	}
+	if h.opts.Extensions == nil {
+		h.opts.Extensions = []string{".html"}
+	}
+	h.exts = make(map[string]bool, len(htmlExts)+len(h.opts.Extensions))
+	for ext := range htmlExts {
+		h.exts[ext] = true
+	}
+	for _, ext := range h.opts.Extensions {
+		h.exts[strings.ToLower(ext)] = true
+	}
+	return h
+}
+
+// candidates returns the pathnames of the templates for the request path in
+// order of priority. it returns nil if the path refers to the hidden file or
+// the file that does not have the extension of the templates.
+func (h *handler) candidates(urlpath string) []string {
+	name := path.Clean("/" + urlpath)
+	if isHiddenPath(name) {
+		return nil
+	}
+	name = strings.TrimPrefix(name, "/")
+
+	if name == "" || strings.HasSuffix(urlpath, "/") {
+		return []string{path.Join(name, h.opts.Index)}
+	} else if ext := path.Ext(name); ext != "" {
+		if !h.exts[strings.ToLower(ext)] {
+			return nil
+		}
+		return []string{name}
+	}
+	list := make([]string, 0, len(h.opts.Extensions)+1)
+	for _, ext := range h.opts.Extensions {
+		list = append(list, name+ext)
+	}
+	return append(list, path.Join(name, h.opts.Index))
+}
+
+// isNotFound returns true if the template itself cannot be loaded
+func isNotFound(err error) bool {
+	return isMissing(err) || errors.Is(err, ErrFrozen)
+}
+
+func contentType(pathname string) string {
+	if htmlExts[strings.ToLower(filepath.Ext(pathname))] {
+		return "text/html; charset=utf-8"
+	} else if ctype := mime.TypeByExtension(filepath.Ext(pathname)); ctype != "" {
+		return ctype
+	}
+	return "text/plain; charset=utf-8"
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		h.serveError(w, r, http.StatusMethodNotAllowed, "", nil)
+		return
+	}
+
+	var err error
+	var pathname string
+	for _, name := range h.candidates(r.URL.Path) {
+		pathname = name
+		var data map[string]interface{}
+		if h.opts.Data != nil {
+			if data, err = h.opts.Data(r, name); err != nil {
+				break
+			}
+		}
+
+		var out *Output
+		if out, err = h.rt.RenderOutput(filepath.FromSlash(name), data); err == nil {
+			w.Header().Set("Content-Type", contentType(name))
+			WriteOutput(w, r, out)
+			return
+		} else if !isNotFound(err) {
+			break
+		}
+	}
+
+	if err == nil || isNotFound(err) {
+		h.serveError(w, r, http.StatusNotFound, "", err)
+		return
+	}
+	h.serveError(w, r, http.StatusInternalServerError, pathname, err)
+}
+
+// serveError writes the error page of the status. the template of the error
+// page is rendered with the following data;
+//
+//	Status: status code
+//	StatusText: text of the status code
+//	Path: request path
+//	Template: pathname of the template that failed to render
+//	Error: error message
+func (h *handler) serveError(w http.ResponseWriter, r *http.Request, status int, pathname string, err error) {
+	if h.opts.Dev && status == http.StatusInternalServerError && err != nil && htmlExts[strings.ToLower(path.Ext(pathname))] {
+		b := bytes.NewBuffer(nil)
+		if h.rt.NewErrorOverlay(pathname, err).WriteHTML(b) == nil {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.WriteHeader(status)
+			if r.Method != http.MethodHead {
+				b.WriteTo(w)
+			}
+			return
+		}
+	}
+
+	if page, ok := h.opts.ErrorPages[status]; ok {
+		data := map[string]interface{}{
+			"Status":     status,
+			"StatusText": http.StatusText(status),
+			"Path":       r.URL.Path,
+			"Template":   pathname,
+			"Error":      "",
+		}
+		if err != nil {
+			data["Error"] = err.Error()
+		}
+
+		// render into the buffer to fall back to plain text on failure
+		b := bytes.NewBuffer(nil)
+		if h.rt.Render(b, filepath.FromSlash(page), data) == nil {
+			w.Header().Set("Content-Type", contentType(page))
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.WriteHeader(status)
+			if r.Method != http.MethodHead {
+				b.WriteTo(w)
+			}
+			return
+		}
+	}
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,171 @@
+package templatex
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@header.html":    `{{define "@header.html"}}header{{end}}`,
+		"index.html":      `{{template "@header.html"}} index {{.Path}}`,
+		"about.html":      `about {{.Path}}`,
+		"blog/index.html": `blog index`,
+		"feed.txt":        `feed <{{.Path}}>`,
+		"style.css":       `body { color: {{.Color}} }`,
+		"broken.html":     `{{template "@unknown.html"}}`,
+		".hidden.html":    `hidden`,
+		"config.yaml":     `secret: {{.Path}}`,
+	}
+	// the loader wraps the errors
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, fmt.Errorf("could not load %q: %w", pathname, syscall.ENOENT)
+	}
+	rt := NewEx(readfn, NewMapCache(), nil)
+	h := Handler(rt, &HandlerOptions{
+		Extensions: []string{".html", ".txt", ".CSS"},
+		Data: func(r *http.Request, pathname string) (map[string]interface{}, error) {
+			if r.URL.Query().Get("fail") != "" {
+				return nil, errors.New("data error")
+			}
+			return map[string]interface{}{
+				"Path":  pathname,
+				"Color": "red",
+			}, nil
+		},
+	})
+
+	for _, c := range []struct {
+		method string
+		path   string
+		code   int
+		ctype  string
+		body   string
+	}{
+		{http.MethodGet, "/", 200, "text/html; charset=utf-8", "header index index.html"},
+		{http.MethodGet, "/index.html", 200, "text/html; charset=utf-8", "header index index.html"},
+		// test that infer the extension
+		{http.MethodGet, "/about", 200, "text/html; charset=utf-8", "about about.html"},
+		{http.MethodGet, "/about.html", 200, "text/html; charset=utf-8", "about about.html"},
+		// test that resolve the index of the directory
+		{http.MethodGet, "/blog/", 200, "text/html; charset=utf-8", "blog index"},
+		{http.MethodGet, "/blog", 200, "text/html; charset=utf-8", "blog index"},
+		// test that render the text template by extension
+		{http.MethodGet, "/feed.txt", 200, "text/plain; charset=utf-8", "feed <feed.txt>"},
+		{http.MethodGet, "/style.css", 200, "text/css; charset=utf-8", "body { color: red }"},
+		// test that the partials and hidden files cannot be requested
+		{http.MethodGet, "/@header.html", 404, "", ""},
+		{http.MethodGet, "/.hidden.html", 404, "", ""},
+		{http.MethodGet, "/blog/../@header.html", 404, "", ""},
+		// test that the files that do not have the template extensions cannot
+		// be requested
+		{http.MethodGet, "/config.yaml", 404, "", ""},
+		{http.MethodGet, "/config", 404, "", ""},
+		// test that responds with 404 if the template does not exist
+		{http.MethodGet, "/unknown", 404, "", ""},
+		{http.MethodGet, "/unknown.html", 404, "", ""},
+		// test that responds with 500 if the template cannot be rendered
+		{http.MethodGet, "/broken.html", 500, "", ""},
+		{http.MethodGet, "/about?fail=1", 500, "", ""},
+		// test that responds with 405 for the other methods
+		{http.MethodPost, "/about", 405, "", ""},
+		{http.MethodHead, "/about", 200, "text/html; charset=utf-8", ""},
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(c.method, c.path, nil)
+		h.ServeHTTP(w, r)
+		assert.Equal(t, c.code, w.Code, "%s %s", c.method, c.path)
+		if c.code == http.StatusOK {
+			assert.Equal(t, c.ctype, w.Header().Get("Content-Type"), c.path)
+			assert.Equal(t, c.body, w.Body.String(), c.path)
+		}
+	}
+
+	// test that responds with 304 if the ETag matches
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/about", nil))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	r := httptest.NewRequest(http.MethodGet, "/about", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	// test that use the default options
+	w = httptest.NewRecorder()
+	Handler(rt, nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/about", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "about ", w.Body.String())
+	w = httptest.NewRecorder()
+	Handler(rt, nil).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/feed.txt", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandler_ErrorPages(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"broken.html":      `{{template "@unknown.html"}}`,
+		"@errors/404.html": `<h1>{{.Status}} {{.StatusText}}</h1><p>{{.Path}}</p>`,
+		"@errors/500.html": `<h1>{{.Status}}</h1><p>{{.Template}}: {{.Error}}</p>`,
+		"@errors/405.html": `{{template "@missing.html"}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	rt := NewEx(readfn, NewMapCache(), nil)
+	h := Handler(rt, &HandlerOptions{
+		ErrorPages: map[int]string{
+			http.StatusNotFound:            "@errors/404.html",
+			http.StatusMethodNotAllowed:    "@errors/405.html",
+			http.StatusInternalServerError: "@errors/500.html",
+		},
+	})
+
+	// test that render the error page of 404
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "<h1>404 Not Found</h1><p>/unknown</p>", w.Body.String())
+
+	// test that render the error page of 500 with the error details
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/broken.html", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Regexp(t, `^<h1>500</h1><p>broken.html: .+@unknown.html.+</p>$`, w.Body.String())
+
+	// test that write only the headers to HEAD request
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	// test that fall back to plain text if the error page fails to render
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "Method Not Allowed\n", w.Body.String())
+
+	// test that fall back to plain text if the error page is not found
+	delete(files, "@errors/404.html")
+	assert.NoError(t, rt.Uncache("@errors/404.html"))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "Not Found\n", w.Body.String())
+}
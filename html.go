@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"text/template/parse"
 )
 
 type HTML struct{}
@@ -45,11 +46,36 @@ func (_ HTML) AddParseTree(dst, src interface{}) error {
 	return nil
 }
 
+// Trees returns the parse trees of the templates associated with tmpl
+func (_ HTML) Trees(tmpl interface{}) map[string]*parse.Tree {
+	trees := make(map[string]*parse.Tree)
+	for _, t := range tmpl.(*template.Template).Templates() {
+		if t.Tree != nil {
+			trees[t.Name()] = t.Tree
+		}
+	}
+	return trees
+}
+
+func (_ HTML) AddTree(tmpl interface{}, name string, tree *parse.Tree) error {
+	_, err := tmpl.(*template.Template).AddParseTree(name, tree)
+	return err
+}
+
 func (_ HTML) Lookup(tmpl interface{}, name string) (interface{}, bool) {
 	t := tmpl.(*template.Template).Lookup(name)
 	return t, t != nil
 }
 
+func (_ HTML) Funcs(tmpl interface{}, funcs map[string]interface{}) {
+	tmpl.(*template.Template).Funcs(funcs)
+}
+
+// Raw returns s as the value that is written without escaping
+func (_ HTML) Raw(s string) interface{} {
+	return template.HTML(s)
+}
+
 func (_ HTML) ParseString(tmpl interface{}, str string) (interface{}, error) {
 	return tmpl.(*template.Template).Parse(str)
 }
@@ -0,0 +1,67 @@
+package templatex
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// maxIncludeDepth is the maximum depth of the nested includes to stop the
+// infinite recursion
+const maxIncludeDepth = 100
+
+// checkIncludeName returns an error if the name chosen at execution time can
+// refer to the file that is not the partial in the template tree
+func checkIncludeName(name string) error {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return fmt.Errorf("include %q: must not be the absolute path", name)
+	}
+	for _, seg := range strings.Split(filepath.ToSlash(name), "/") {
+		if seg == ".." {
+			return fmt.Errorf("include %q: must not contain \"..\"", name)
+		}
+	}
+	if !strings.HasPrefix(filepath.Clean(name), "@") {
+		return fmt.Errorf("include %q: must be prefixed with \"@\"", name)
+	}
+	return nil
+}
+
+// include renders the template of name with data through the loader and the
+// cache of the render, and returns the output. the included template is
+// recorded as the dependency of the template being executed.
+func (x *execution) include(name string, data ...interface{}) (interface{}, error) {
+	if len(data) > 1 {
+		return nil, fmt.Errorf("include %q: too many arguments", name)
+	} else if x.depth >= maxIncludeDepth {
+		return nil, fmt.Errorf("include %q: exceeded maximum include depth %d", name, maxIncludeDepth)
+	}
+
+	if err := checkIncludeName(name); err != nil {
+		return nil, err
+	}
+	name = filepath.Clean(name)
+	f, err := x.t.preprocess(x.s, name)
+	if err != nil {
+		return nil, err
+	}
+	// the file being executed depends on the included file, so the fragments
+	// and the outputs that depend on the file are deleted together
+	if x.file != nil {
+		x.file.addChild(f)
+		f.addParent(x.file)
+	}
+
+	var v interface{}
+	if len(data) > 0 {
+		v = data[0]
+	}
+	x.depth++
+	defer func() { x.depth-- }()
+	b := bytes.NewBuffer(nil)
+	if err = x.execute(f, b, v); err != nil {
+		return nil, err
+	}
+	return x.t.renderer.Raw(b.String()), nil
+}
@@ -0,0 +1,268 @@
+package templatex
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/mah0x211/templatex/builtins"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntime_Include(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@widget/text.html":  `{{define "@widget/text.html"}}<p>{{.Text}}</p>{{end}}`,
+		"@widget/list.html":  `<ul>{{range .Items}}<li>{{include "@widget/item.html" .}}</li>{{end}}</ul>`,
+		"@widget/item.html":  `{{.}}`,
+		"@widget/plain.html": `plain`,
+		"@recursive.html":    `{{include "@recursive.html"}}`,
+		"@layout.html":       `<main>{{template "content" .}}</main>`,
+		"index.html":         `{{define "content"}}{{range .Widgets}}{{include .Template .}}{{end}}{{end}}{{layout "@layout.html"}}`,
+		"index.txt":          `{{include "@widget/text.html" .}} {{include "@widget/plain.html"}}`,
+		"missing.html":       `{{include "@unknown.html"}}`,
+		"arguments.html":     `{{include "@widget/plain.html" . .}}`,
+		"recursive.html":     `{{include "@recursive.html"}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	cache := NewMapCache()
+	rt := NewEx(readfn, cache, builtins.FuncMap())
+	data := map[string]interface{}{
+		"Widgets": []map[string]interface{}{
+			{"Template": "@widget/text.html", "Text": "<hello>"},
+			{"Template": "./@widget/list.html", "Items": []string{"a", "<b>"}},
+		},
+	}
+
+	// test that include the templates chosen by the data
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt.RenderHTML(b, "index.html", data))
+	assert.Equal(t, "<main><p>&lt;hello&gt;</p><ul><li>a</li><li>&lt;b&gt;</li></ul></main>", b.String())
+
+	// test that the included templates are cached
+	for _, name := range []string{"@widget/text.html", "@widget/list.html", "@widget/item.html"} {
+		assert.NotNil(t, cache.Get(name), name)
+	}
+
+	// test that include the templates with text/template
+	b.Reset()
+	assert.NoError(t, rt.RenderText(b, "index.txt", map[string]interface{}{"Text": "<hello>"}))
+	assert.Equal(t, "<p><hello></p> plain", b.String())
+
+	// test that render the templates concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := bytes.NewBuffer(nil)
+			assert.NoError(t, rt.RenderHTML(b, "index.html", data))
+			assert.Equal(t, "<main><p>&lt;hello&gt;</p><ul><li>a</li><li>&lt;b&gt;</li></ul></main>", b.String())
+		}()
+	}
+	wg.Wait()
+
+	// test that returns an error if the template does not exist
+	err := rt.RenderHTML(bytes.NewBuffer(nil), "missing.html", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "error calling include")
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+
+	// test that returns an error if too many arguments are passed
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "arguments.html", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `include "@widget/plain.html": too many arguments`)
+
+	// test that returns an error if the includes are nested too deeply
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "recursive.html", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `include "@recursive.html": exceeded maximum include depth 100`)
+
+	// test that returns an error if the name can refer to the file that is not
+	// the partial in the template tree
+	files["dynamic.html"] = `{{include .T}}`
+	files["../secret.html"] = `secret`
+	files["/secret.html"] = `secret`
+	files["plain.html"] = `plain`
+	for name, msg := range map[string]string{
+		"../secret.html":            `include "../secret.html": must not contain ".."`,
+		"@widget/../../secret.html": `include "@widget/../../secret.html": must not contain ".."`,
+		"/secret.html":              `include "/secret.html": must not be the absolute path`,
+		"plain.html":                `include "plain.html": must be prefixed with "@"`,
+	} {
+		err = rt.RenderHTML(bytes.NewBuffer(nil), "dynamic.html", map[string]interface{}{"T": name})
+		assert.Error(t, err, name)
+		assert.Contains(t, err.Error(), msg, name)
+	}
+
+	// test that returns an error if called outside of the rendering
+	_, err = unboundFunc("include")("@widget/plain.html")
+	assert.Error(t, err)
+}
+
+func TestRuntime_OptionalInclude(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@header.html":   `{{define "@header.html"}}header {{end}}`,
+		"@broken.html":   `{{define "@broken.html"}}{{template "@unknown.html"}}{{end}}`,
+		"index.html":     `{{template "@?header.html" .}}{{template "@?promo.html" .}}hello`,
+		"required.html":  `{{template "@promo.html" .}}`,
+		"broken.html":    `{{template "@?broken.html"}}`,
+		"layout.html":    `{{layout "@?layout.html"}}`,
+		"multiline.html": "{{template \"@?promo.html\"}}\n{{template \"@?unknown.html\"}}\n{{end}}",
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	cache := NewMapCache()
+	rt := NewEx(readfn, cache, builtins.FuncMap())
+
+	// test that include nothing if the template does not exist
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt.RenderHTML(b, "index.html", nil))
+	assert.Equal(t, "header hello", b.String())
+
+	// test that the missing template is tracked as the dependency
+	g, err := rt.Graph()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"index.html"}, g.Dependents("@promo.html"))
+
+	// test that returns an error if the missing template is included without "?"
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "required.html", nil)
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+
+	// test that the template is uncached when the missing template is created
+	files["@promo.html"] = `{{define "@promo.html"}}promo {{end}}`
+	assert.NoError(t, rt.Uncache("@promo.html"))
+	assert.Nil(t, cache.Get("index.html"))
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "index.html", nil))
+	assert.Equal(t, "header promo hello", b.String())
+
+	// test that the template is uncached when the missing template is loaded
+	// by the other template
+	delete(files, "@promo.html")
+	assert.NoError(t, rt.Uncache("@promo.html"))
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "index.html", nil))
+	assert.Equal(t, "header hello", b.String())
+	files["@promo.html"] = `{{define "@promo.html"}}new promo {{end}}`
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "required.html", nil))
+	assert.Equal(t, "new promo ", b.String())
+	assert.Nil(t, cache.Get("index.html"))
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "index.html", nil))
+	assert.Equal(t, "header new promo hello", b.String())
+
+	// test that returns an error if the optional template cannot be parsed
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "broken.html", nil)
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+
+	// test that returns an error if the layout is optional
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "layout.html", nil)
+	assert.True(t, errors.Is(err, ErrOptionalLayout))
+
+	// test that the line number of the error is not changed
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "multiline.html", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "multiline.html:3")
+
+	// test that include nothing without the cache
+	rt = NewEx(readfn, NewNopCache(), builtins.FuncMap())
+	delete(files, "@header.html")
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "index.html", nil))
+	assert.Equal(t, "new promo hello", b.String())
+
+	// test that include nothing if the loader wraps the error
+	rt = NewEx(func(pathname string) ([]byte, error) {
+		b, err := readfn(pathname)
+		if err != nil {
+			return nil, fmt.Errorf("could not load %q: %w", pathname, err)
+		}
+		return b, nil
+	}, NewMapCache(), builtins.FuncMap())
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "index.html", nil))
+	assert.Equal(t, "new promo hello", b.String())
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "broken.html", nil)
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+}
+
+func TestRuntime_FallbackInclude(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@header.html":      `{{define "@header.html"}}default{{end}}`,
+		"@beta/header.html": `{{define "@beta/header.html"}}beta{{end}}`,
+		"@layout.html":      `<main>{{template "content" .}}</main>`,
+		"index.html":        `{{template "@acme/header.html|@beta/header.html|@header.html" .}} {{template "@header.html"}}`,
+		"optional.html":     `[{{template "@acme/footer.html|@?footer.html" .}}]`,
+		"required.html":     `{{template "@acme/footer.html|@footer.html" .}}`,
+		"invalid.html":      `{{template "@acme/header.html|header.html" .}}`,
+		"layout.html":       `{{define "content"}}hello{{end}}{{layout "@acme/layout.html|@layout.html"}}`,
+		"opt_layout.html":   `{{define "content"}}hello{{end}}{{layout "@acme/layout.html|@?beta/layout.html"}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	cache := NewMapCache()
+	rt := NewEx(readfn, cache, builtins.FuncMap())
+	render := func(name string) string {
+		b := bytes.NewBuffer(nil)
+		assert.NoError(t, rt.RenderHTML(b, name, nil))
+		return b.String()
+	}
+
+	// test that include the first template that exists
+	assert.Equal(t, "beta default", render("index.html"))
+	assert.Equal(t, "<main>hello</main>", render("layout.html"))
+
+	// test that the missing candidates are tracked as the dependencies
+	g, err := rt.Graph()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"@acme/header.html", "@beta/header.html", "@header.html"}, g.Dependencies("index.html"))
+	assert.Equal(t, []string{"index.html"}, g.Dependents("@acme/header.html"))
+
+	// test that the template is uncached when the higher priority template is
+	// created
+	files["@acme/header.html"] = `{{define "@acme/header.html"}}acme{{end}}`
+	assert.NoError(t, rt.Uncache("@acme/header.html"))
+	assert.Nil(t, cache.Get("index.html"))
+	assert.Equal(t, "acme default", render("index.html"))
+
+	// test that include nothing if the last candidate is optional
+	assert.Equal(t, "[]", render("optional.html"))
+
+	// test that returns an error if any candidate of the layout is optional
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "opt_layout.html", nil)
+	assert.True(t, errors.Is(err, ErrOptionalLayout))
+
+	// test that returns an error if none of the candidates exist
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "required.html", nil)
+	var perr *PreprocessError
+	assert.True(t, errors.As(err, &perr))
+	assert.Equal(t, "@acme/footer.html|@footer.html", perr.Value)
+	assert.True(t, errors.Is(err, syscall.ENOENT))
+
+	// test that returns an error if the candidate is not prefixed with "@"
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "invalid.html", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid include name "header.html"`)
+}
@@ -0,0 +1,139 @@
+package templatex
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Output is the rendered output of the template
+type Output struct {
+	Body []byte
+	// strong entity tag of Body
+	ETag string
+}
+
+// ETag returns the strong entity tag of b
+func ETag(b []byte) string {
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// MatchETag returns true if the If-None-Match header of r matches etag
+func MatchETag(r *http.Request, etag string) bool {
+	for _, v := range r.Header.Values("If-None-Match") {
+		for _, tag := range strings.Split(v, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteOutput writes the output to w with the ETag header. it responds with
+// 304 Not Modified if the If-None-Match header of r matches the ETag.
+func WriteOutput(w http.ResponseWriter, r *http.Request, out *Output) error {
+	w.Header().Set("ETag", out.ETag)
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		if MatchETag(r, out.ETag) {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(len(out.Body)))
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	_, err := w.Write(out.Body)
+	return err
+}
+
+// SetOutputCache sets the store of the outputs of RenderOutput. the outputs
+// are stored for the ttl, and the ttl 0 means they never expire. the outputs
+// are deleted from the store when the templates that they depend on are
+// uncached. the outputs are not cached if the store is nil.
+func (rt *Runtime) SetOutputCache(store FragmentStore, ttl time.Duration) {
+	rt.outputs = store
+	rt.outputTTL = ttl
+}
+
+// WithCacheKey caches the output of RenderOutput by the key. the key must
+// identify the data passed to the template since the same output is returned
+// for the same key until the template is changed. the output is not cached
+// without the key.
+func WithCacheKey(key string) RenderOption {
+	return func(o *renderOptions) {
+		o.cacheKey = key
+	}
+}
+
+func (t *Template) Output(pathname string, data map[string]interface{}, opts ...RenderOption) (*Output, error) {
+	s := newSession(t, t.Cache())
+	o := newRenderOptions(opts)
+	f, err := t.load(s, pathname, o)
+	if err != nil {
+		return nil, err
+	}
+
+	// the output is keyed by the version of the template and the cache key
+	store := t.outputs
+	var key string
+	if store != nil && o.cacheKey != "" {
+		key = fmt.Sprintf("%T\x00%s\x00%s\x00%s", t.renderer, f.key, f.digest, o.cacheKey)
+		if v, ok := store.Get(key); ok {
+			if out, ok := decodeOutput(v); ok {
+				return out, nil
+			}
+		}
+	}
+
+	b := bytes.NewBuffer(nil)
+	if err = t.execute(s, f, b, data); err != nil {
+		return nil, err
+	}
+	out := &Output{
+		Body: b.Bytes(),
+		ETag: ETag(b.Bytes()),
+	}
+	if key != "" {
+		store.Set(key, encodeOutput(out), t.outputTTL)
+		// the output is deleted when the template or the templates that it
+		// depends on, including the ones loaded at the execution time, are
+		// uncached
+		if !f.addFragment(store, key) {
+			store.Delete(key)
+		}
+	}
+	return out, nil
+}
+
+// encodeOutput encodes the output to store with its ETag
+func encodeOutput(out *Output) string {
+	return out.ETag + "\n" + string(out.Body)
+}
+
+func decodeOutput(v string) (*Output, bool) {
+	i := strings.IndexByte(v, '\n')
+	if i < 0 {
+		return nil, false
+	}
+	return &Output{
+		Body: []byte(v[i+1:]),
+		ETag: v[:i],
+	}, true
+}
+
+// RenderOutput renders the template like Render, and returns the output with
+// its ETag. the output is cached if the output cache is set and the cache key
+// is specified by WithCacheKey.
+func (rt *Runtime) RenderOutput(pathname string, data map[string]interface{}, opts ...RenderOption) (*Output, error) {
+	pathname = filepath.Clean(pathname)
+	return rt.templateFor(pathname).Output(pathname, data, opts...)
+}
@@ -0,0 +1,179 @@
+package templatex
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mah0x211/templatex/builtins"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETag(t *testing.T) {
+	// test that returns the same strong entity tag for the same content
+	etag := ETag([]byte("hello"))
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+	assert.Equal(t, etag, ETag([]byte("hello")))
+	assert.NotEqual(t, etag, ETag([]byte("world")))
+}
+
+func TestMatchETag(t *testing.T) {
+	for _, c := range []struct {
+		header string
+		exp    bool
+	}{
+		{`"foo"`, true},
+		{`W/"foo"`, true},
+		{`"bar", "foo"`, true},
+		{`*`, true},
+		{`"bar"`, false},
+		{``, false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.header != "" {
+			r.Header.Set("If-None-Match", c.header)
+		}
+		assert.Equal(t, c.exp, MatchETag(r, `"foo"`), c.header)
+	}
+}
+
+func TestWriteOutput(t *testing.T) {
+	out := &Output{
+		Body: []byte("hello"),
+		ETag: ETag([]byte("hello")),
+	}
+
+	// test that write the output with the ETag
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.NoError(t, WriteOutput(w, r, out))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, out.ETag, w.Header().Get("ETag"))
+	assert.Equal(t, "5", w.Header().Get("Content-Length"))
+	assert.Equal(t, "hello", w.Body.String())
+
+	// test that responds with 304 if the ETag matches
+	w = httptest.NewRecorder()
+	r.Header.Set("If-None-Match", out.ETag)
+	assert.NoError(t, WriteOutput(w, r, out))
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, out.ETag, w.Header().Get("ETag"))
+	assert.Empty(t, w.Body.String())
+
+	// test that write only the headers to HEAD request
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodHead, "/", nil)
+	assert.NoError(t, WriteOutput(w, r, out))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "5", w.Header().Get("Content-Length"))
+	assert.Empty(t, w.Body.String())
+}
+
+func TestRuntime_RenderOutput(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@footer.html": `{{define "@footer.html"}}v1{{end}}`,
+		"index.html":   `hello {{.World}} {{count}} {{template "@footer.html"}}`,
+		"index.txt":    `hello {{.World}} {{count}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	n := 0
+	funcs := builtins.FuncMap()
+	funcs["count"] = func() int {
+		n++
+		return n
+	}
+	rt := NewEx(readfn, NewMapCache(), funcs)
+	data := map[string]interface{}{
+		"World": "<world>",
+	}
+
+	// test that render the output without the cache
+	out, err := rt.RenderOutput("index.html", data)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello &lt;world&gt; 1 v1", string(out.Body))
+	assert.Equal(t, ETag(out.Body), out.ETag)
+	out, err = rt.RenderOutput("index.html", data)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello &lt;world&gt; 2 v1", string(out.Body))
+
+	// test that the output is not cached without the cache key
+	rt.SetOutputCache(NewMemoryFragmentStore(), time.Minute)
+	out, err = rt.RenderOutput("index.html", data)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello &lt;world&gt; 3 v1", string(out.Body))
+
+	// test that use the cached output for the same template and cache key
+	out, err = rt.RenderOutput("index.html", data, WithCacheKey("world"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello &lt;world&gt; 4 v1", string(out.Body))
+	etag := out.ETag
+	out, err = rt.RenderOutput("./index.html", map[string]interface{}{"World": "<world>"}, WithCacheKey("world"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello &lt;world&gt; 4 v1", string(out.Body))
+	assert.Equal(t, etag, out.ETag)
+
+	// test that the outputs are cached for each cache key
+	out, err = rt.RenderOutput("index.html", map[string]interface{}{"World": "foo"}, WithCacheKey("foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello foo 5 v1", string(out.Body))
+
+	// test that render the text template by extension
+	out, err = rt.RenderOutput("index.txt", data, WithCacheKey("world"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello <world> 6", string(out.Body))
+
+	// test that the cached output is not used after the template is changed
+	files["@footer.html"] = `{{define "@footer.html"}}v2{{end}}`
+	assert.NoError(t, rt.Uncache("@footer.html"))
+	out, err = rt.RenderOutput("index.html", data, WithCacheKey("world"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello &lt;world&gt; 7 v2", string(out.Body))
+	assert.NotEqual(t, etag, out.ETag)
+
+	// test that the cached output is deleted when the template included at
+	// the execution time is uncached
+	store := NewMemoryFragmentStore()
+	rt.SetOutputCache(store, 0)
+	files["@w.html"] = `w1`
+	files["widget.html"] = `{{include "@w.html"}} {{count}}`
+	out, err = rt.RenderOutput("widget.html", nil, WithCacheKey("widget"))
+	assert.NoError(t, err)
+	assert.Equal(t, "w1 8", string(out.Body))
+	etag = out.ETag
+	out, err = rt.RenderOutput("widget.html", nil, WithCacheKey("widget"))
+	assert.NoError(t, err)
+	assert.Equal(t, "w1 8", string(out.Body))
+	assert.Equal(t, etag, out.ETag)
+	files["@w.html"] = `w2`
+	assert.NoError(t, rt.Uncache("@w.html"))
+	assert.Empty(t, store.data)
+	out, err = rt.RenderOutput("widget.html", nil, WithCacheKey("widget"))
+	assert.NoError(t, err)
+	assert.Equal(t, "w2 9", string(out.Body))
+	assert.Equal(t, ETag(out.Body), out.ETag)
+
+	// test that the outputs of the data that cannot be distinguished by JSON
+	// are not mixed up
+	type user struct {
+		name string
+	}
+	files["user.txt"] = `hi {{printf "%v" .U}}`
+	for _, name := range []string{"alice", "bob"} {
+		out, err = rt.RenderOutput("user.txt", map[string]interface{}{"U": &user{name}})
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("hi &{%s}", name), string(out.Body))
+	}
+
+	// test that returns an error if the template does not exist
+	_, err = rt.RenderOutput("unknown.html", data)
+	assert.Error(t, err)
+}
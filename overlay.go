@@ -0,0 +1,157 @@
+package templatex
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// overlayContext is the number of the source lines to show around the line
+// where the error occurred
+const overlayContext = 3
+
+// ErrorFrame is the location in the chain of the templates that includes or
+// extends the template where the error occurred. Line is 0 if unknown.
+type ErrorFrame struct {
+	Name string
+	Line int
+}
+
+// SourceLine is the line of the template source. Error is true if the error
+// occurred at the line.
+type SourceLine struct {
+	Line  int
+	Text  string
+	Error bool
+}
+
+// ErrorOverlay is the details of the error that occurred while rendering the
+// template to show to the developers.
+type ErrorOverlay struct {
+	Error string
+	// Name and Line are the location where the error occurred
+	Name  string
+	Line  int
+	Chain []ErrorFrame
+	// Source is the lines around the error location
+	Source []SourceLine
+}
+
+// reErrorLocation matches the location in the error message of
+// text/template and html/template, e.g. "template: foo.html:3:5: ..."
+var reErrorLocation = regexp.MustCompile(`template: (\S+?):(\d+)(?::\d+)?:`)
+
+// errorChain returns the chain of the locations from the template of pathname
+// to the location where the err occurred
+func errorChain(pathname string, err error) []ErrorFrame {
+	chain := []ErrorFrame{{Name: pathname}}
+	add := func(name string, line int) {
+		if last := &chain[len(chain)-1]; last.Name == name && (last.Line == 0 || last.Line == line) {
+			last.Line = line
+			return
+		}
+		chain = append(chain, ErrorFrame{Name: name, Line: line})
+	}
+
+	// preprocessing errors are nested from the including template
+	var pe *PreprocessError
+	for errors.As(err, &pe) {
+		add(pe.Name, pe.Line)
+		err = pe.Err
+	}
+
+	// rendering errors are nested in the message by the include function
+	for _, m := range reErrorLocation.FindAllStringSubmatch(err.Error(), -1) {
+		line, _ := strconv.Atoi(m[2])
+		add(m[1], line)
+	}
+	return chain
+}
+
+// source reads the original source of the template through the loader. the
+// text of the cached template cannot be used since it is modified by the
+// preprocessing.
+func (rt *Runtime) source(name string) (string, bool) {
+	b, err := rt.readfn(filepath.FromSlash(name))
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// NewErrorOverlay returns the details of the err that occurred while
+// rendering the template of pathname.
+func (rt *Runtime) NewErrorOverlay(pathname string, err error) *ErrorOverlay {
+	o := &ErrorOverlay{
+		Error: err.Error(),
+		Chain: errorChain(pathname, err),
+	}
+	last := o.Chain[len(o.Chain)-1]
+	o.Name, o.Line = last.Name, last.Line
+
+	if src, ok := rt.source(o.Name); ok && o.Line > 0 {
+		lines := strings.Split(src, "\n")
+		head := o.Line - overlayContext
+		if head < 1 {
+			head = 1
+		}
+		tail := o.Line + overlayContext
+		if tail > len(lines) {
+			tail = len(lines)
+		}
+		for i := head; i <= tail; i++ {
+			o.Source = append(o.Source, SourceLine{
+				Line:  i,
+				Text:  strings.TrimSuffix(lines[i-1], "\r"),
+				Error: i == o.Line,
+			})
+		}
+	}
+	return o
+}
+
+var overlayTemplate = template.Must(template.New("overlay").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Name}}{{if .Line}}:{{.Line}}{{end}}</title>
+<style>
+body { margin: 0; padding: 2em; background: #1e1e1e; color: #ddd; font: 14px/1.5 monospace; }
+h1 { margin: 0 0 1em; color: #ff6b6b; font-size: 1.2em; }
+pre { margin: 0 0 1.5em; white-space: pre-wrap; word-break: break-all; }
+ol.chain { margin: 0 0 1.5em; padding-left: 1.5em; color: #aaa; }
+table.source { border-collapse: collapse; width: 100%; background: #252525; }
+table.source td { padding: 0 .75em; white-space: pre; }
+table.source td.line { width: 1%; text-align: right; color: #777; }
+table.source tr.error { background: #5a1d1d; color: #fff; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}{{if .Line}}:{{.Line}}{{end}}</h1>
+<pre>{{.Error}}</pre>
+{{- if gt (len .Chain) 1}}
+<ol class="chain">
+{{- range .Chain}}
+<li>{{.Name}}{{if .Line}}:{{.Line}}{{end}}</li>
+{{- end}}
+</ol>
+{{- end}}
+{{- if .Source}}
+<table class="source">
+{{- range .Source}}
+<tr{{if .Error}} class="error"{{end}}><td class="line">{{.Line}}</td><td>{{.Text}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteHTML writes the html page of the overlay to w
+func (o *ErrorOverlay) WriteHTML(w io.Writer) error {
+	return overlayTemplate.Execute(w, o)
+}
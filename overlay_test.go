@@ -0,0 +1,128 @@
+package templatex
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntime_NewErrorOverlay(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@layout.html":      "<html>\n<body>\n{{template \"content\" .}}\n</body>\n</html>",
+		"@invalid.html":     "line1\nline2\n{{if}}\nline4",
+		"@exec.html":        "line1\n{{.Foo.Bar}}",
+		"syntax.html":       "line1\nline2\nline3\n{{.Foo}\nline5\nline6\nline7\nline8",
+		"with_layout.html":  "{{layout \"@layout.html\"}}\n{{define \"content\"}}\n{{template \"@invalid.html\"}}\n{{end}}",
+		"with_include.html": "line1\n{{include \"@exec.html\" .}}",
+		"preprocessed.html": "{{layout \"@layout.html\"}}{{define \"content\"}}{{template \"@?missing.html\"}}\n{{.Foo.Bar}}\n{{end}}",
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	rt := NewEx(readfn, NewMapCache(), nil)
+	data := map[string]interface{}{
+		"Foo": 1,
+	}
+
+	// test that show the source lines around the syntax error
+	err := rt.RenderHTML(bytes.NewBuffer(nil), "syntax.html", data)
+	assert.Error(t, err)
+	o := rt.NewErrorOverlay("syntax.html", err)
+	assert.Equal(t, err.Error(), o.Error)
+	assert.Equal(t, "syntax.html", o.Name)
+	assert.Equal(t, 4, o.Line)
+	assert.Equal(t, []ErrorFrame{{Name: "syntax.html", Line: 4}}, o.Chain)
+	assert.Equal(t, []SourceLine{
+		{Line: 1, Text: "line1"},
+		{Line: 2, Text: "line2"},
+		{Line: 3, Text: "line3"},
+		{Line: 4, Text: "{{.Foo}", Error: true},
+		{Line: 5, Text: "line5"},
+		{Line: 6, Text: "line6"},
+		{Line: 7, Text: "line7"},
+	}, o.Source)
+
+	// test that show the chain of the preprocessed templates
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "with_layout.html", data)
+	assert.Error(t, err)
+	o = rt.NewErrorOverlay("with_layout.html", err)
+	assert.Equal(t, "@invalid.html", o.Name)
+	assert.Equal(t, 3, o.Line)
+	assert.Equal(t, []ErrorFrame{
+		{Name: "with_layout.html", Line: 3},
+		{Name: "@invalid.html", Line: 3},
+	}, o.Chain)
+	assert.Equal(t, []SourceLine{
+		{Line: 1, Text: "line1"},
+		{Line: 2, Text: "line2"},
+		{Line: 3, Text: "{{if}}", Error: true},
+		{Line: 4, Text: "line4"},
+	}, o.Source)
+
+	// test that show the chain of the included templates
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "with_include.html", data)
+	assert.Error(t, err)
+	o = rt.NewErrorOverlay("with_include.html", err)
+	assert.Equal(t, "@exec.html", o.Name)
+	assert.Equal(t, 2, o.Line)
+	assert.Equal(t, []ErrorFrame{
+		{Name: "with_include.html", Line: 2},
+		{Name: "@exec.html", Line: 2},
+	}, o.Chain)
+	assert.Equal(t, []SourceLine{
+		{Line: 1, Text: "line1"},
+		{Line: 2, Text: "{{.Foo.Bar}}", Error: true},
+	}, o.Source)
+
+	// test that write the overlay page
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, o.WriteHTML(b))
+	assert.Contains(t, b.String(), "<h1>@exec.html:2</h1>")
+	assert.Contains(t, b.String(), "<li>with_include.html:2</li>")
+	assert.Contains(t, b.String(), `<tr class="error"><td class="line">2</td><td>{{.Foo.Bar}}</td></tr>`)
+
+	// test that show the original source that is not preprocessed
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "preprocessed.html", data)
+	assert.Error(t, err)
+	o = rt.NewErrorOverlay("preprocessed.html", err)
+	assert.Equal(t, "preprocessed.html", o.Name)
+	assert.Equal(t, 2, o.Line)
+	assert.Equal(t, []SourceLine{
+		{Line: 1, Text: `{{layout "@layout.html"}}{{define "content"}}{{template "@?missing.html"}}`},
+		{Line: 2, Text: "{{.Foo.Bar}}", Error: true},
+		{Line: 3, Text: "{{end}}"},
+	}, o.Source)
+
+	// test that no source lines if the location is unknown
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "unknown.html", data)
+	assert.Error(t, err)
+	o = rt.NewErrorOverlay("unknown.html", err)
+	assert.Equal(t, "unknown.html", o.Name)
+	assert.Equal(t, 0, o.Line)
+	assert.Empty(t, o.Source)
+
+	// test that the handler writes the overlay in dev mode
+	h := Handler(rt, &HandlerOptions{
+		Data: func(*http.Request, string) (map[string]interface{}, error) {
+			return data, nil
+		},
+		Dev: true,
+	})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/with_include", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<h1>@exec.html:2</h1>")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "Not Found\n", w.Body.String())
+}
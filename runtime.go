@@ -1,11 +1,18 @@
 package templatex
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/mah0x211/templatex/builtins"
 )
@@ -16,25 +23,93 @@ func DefaultReadFunc(pathname string) ([]byte, error) {
 	return ioutil.ReadFile(pathname)
 }
 
+// ListFunc returns the pathnames of the files that can be read by ReadFunc
+type ListFunc func() ([]string, error)
+
+// DefaultListFunc returns the pathnames of the regular files under the current
+// directory except hidden files.
+func DefaultListFunc() ([]string, error) {
+	return DirListFunc(".")()
+}
+
+// DirReadFunc returns the ReadFunc that reads the files under the root
+// directory. the pathname cannot refer to the files outside of the root.
+func DirReadFunc(root string) ReadFunc {
+	return func(pathname string) ([]byte, error) {
+		return ioutil.ReadFile(filepath.Join(root, filepath.Clean("/"+pathname)))
+	}
+}
+
+// DirListFunc returns the ListFunc that returns the pathnames of the regular
+// files under the root directory except hidden files. the pathnames are
+// relative to the root.
+func DirListFunc(root string) ListFunc {
+	return func() ([]string, error) {
+		var list []string
+		err := filepath.Walk(root, func(pathname string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			} else if pathname != root && strings.HasPrefix(info.Name(), ".") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			} else if info.Mode().IsRegular() {
+				rel, err := filepath.Rel(root, pathname)
+				if err != nil {
+					return err
+				}
+				list = append(list, rel)
+			}
+			return nil
+		})
+		return list, err
+	}
+}
+
 type xTemplate interface {
-	Render(w io.Writer, pathname string, data map[string]interface{}) error
+	Render(w io.Writer, pathname string, data map[string]interface{}, opts ...RenderOption) error
+	Output(pathname string, data map[string]interface{}, opts ...RenderOption) (*Output, error)
 	Parse(f *File, text string, layout *File, includes map[string]*File) error
+	execute(s *session, f *File, w io.Writer, data map[string]interface{}) error
+}
+
+// cacheHolder wraps Cache to store the different implementations into the
+// atomic.Value
+type cacheHolder struct {
+	Cache
 }
 
 type Runtime struct {
 	readfn ReadFunc
-	cache  Cache
+	listfn ListFunc
+	mu     sync.Mutex
+	cache  atomic.Value
 	funcs  map[string]interface{}
 	text   xTemplate
 	html   xTemplate
+	bus    Bus
+	frozen int32
+	// store of the fragments enclosed by {{cache}}
+	fragments FragmentStore
+	// store of the outputs of RenderOutput
+	outputs   FragmentStore
+	outputTTL time.Duration
+	// parse the front matter of the templates if true
+	frontMatter bool
 }
 
+// NewEx creates the runtime with the functions that can be called from the
+// templates. it panics if funcs contains the name of the function provided by
+// the runtime such as include, component, body, push, stack, set, get,
+// incr, append, cache, props and super.
 func NewEx(readfn ReadFunc, cache Cache, funcs map[string]interface{}) *Runtime {
 	rt := &Runtime{
 		readfn: readfn,
-		cache:  cache,
+		listfn: DefaultListFunc,
 		funcs:  funcs,
 	}
+	rt.cache.Store(cacheHolder{cache})
 	rt.text = NewTemplate(rt, NewText())
 	rt.html = NewTemplate(rt, NewHTML())
 	return rt
@@ -49,27 +124,347 @@ var reTemplateAction = regexp.MustCompile(
 	`[^{]*(\{{2}\s*(template|layout)\s+"(@[^"]+)"[^}]*}{2})`,
 )
 
-func (rt *Runtime) preprocess(t xTemplate, pathname string, cref map[string]struct{}) (*File, error) {
-	// get cached template
-	f := rt.cache.Get(pathname)
-	if f != nil {
+// Cache returns the current template set
+func (rt *Runtime) Cache() Cache {
+	return rt.cache.Load().(cacheHolder).Cache
+}
+
+// Swap replaces the current template set with cache atomically and returns
+// the old one. the renders in progress will be completed with the old one.
+// if the runtime is frozen, the cache will be frozen before replacing.
+func (rt *Runtime) Swap(cache Cache) (Cache, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.IsFrozen() {
+		var err error
+		if cache, err = freezeCache(cache); err != nil {
+			return nil, err
+		}
+	}
+	old := rt.Cache()
+	rt.cache.Store(cacheHolder{cache})
+	return old, nil
+}
+
+var ErrFrozen = errors.New("runtime is frozen")
+
+func freezeCache(cache Cache) (Cache, error) {
+	switch v := cache.(type) {
+	case *FrozenCache:
+		return v, nil
+	case NopCache:
+		return nil, fmt.Errorf("%T cannot be frozen: nothing is loaded", cache)
+	case FileLister:
+		return NewFrozenCache(v.Files()), nil
+	}
+	return nil, fmt.Errorf("%T cannot be frozen: it does not implement FileLister", cache)
+}
+
+// Freeze replaces the current template set with the read-only copy of it.
+// after freezing, the templates that are not contained in the set cannot be
+// rendered, and the loader will not be used. NopCache cannot be frozen since
+// nothing is loaded.
+func (rt *Runtime) Freeze() error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	cache, err := freezeCache(rt.Cache())
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&rt.frozen, 1)
+	rt.cache.Store(cacheHolder{cache})
+	return nil
+}
+
+func (rt *Runtime) IsFrozen() bool {
+	return atomic.LoadInt32(&rt.frozen) == 1
+}
+
+var htmlExts = map[string]bool{
+	".html": true,
+	".htm":  true,
+}
+
+// templateFor returns the html template for the files that have the html
+// extension, otherwise the text template.
+func (rt *Runtime) templateFor(pathname string) xTemplate {
+	if htmlExts[strings.ToLower(filepath.Ext(pathname))] {
+		return rt.html
+	}
+	return rt.text
+}
+
+// Errors is the list of errors that occurred while loading the templates
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// load preprocesses the templates into the cache and returns all errors
+func (rt *Runtime) load(cache Cache, pathnames []string) error {
+	var errs Errors
+	for _, pathname := range pathnames {
+		pathname = filepath.Clean(pathname)
+		t := rt.templateFor(pathname)
+		if _, err := rt.preprocess(newSession(t, cache), pathname); err != nil {
+			errs = append(errs, fmt.Errorf("could not load %q: %w", pathname, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Prepare creates a new template set that contains the specified templates
+// and all their associated templates. it can be installed by Swap. the
+// templates are parsed by the renderer that Render selects like Preload.
+func (rt *Runtime) Prepare(pathnames ...string) (Cache, error) {
+	cache := NewMapCache()
+	if err := rt.load(cache, pathnames); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+func (rt *Runtime) SetListFunc(listfn ListFunc) {
+	rt.listfn = listfn
+}
+
+// Preload preprocesses all the files that returned by ListFunc and matched
+// to the patterns into the current template set. the pattern that does not
+// contain the path separator is matched to the base name of the file. it
+// returns all the errors that occurred.
+//
+// each file is parsed only by the renderer that Render selects for it, that
+// is html/template for the html extension, otherwise text/template. the
+// template set holds one parsed template per pathname, so the file rendered
+// by RenderText or RenderHTML with the other renderer is parsed again at the
+// first render and replaces the preloaded one.
+func (rt *Runtime) Preload(patterns ...string) error {
+	list, err := rt.listfn()
+	if err != nil {
+		return err
+	}
+
+	var pathnames []string
+	var errs Errors
+	for _, pathname := range list {
+		ok, err := matchPatterns(patterns, pathname)
+		if err != nil {
+			errs = append(errs, err)
+			break
+		} else if ok {
+			pathnames = append(pathnames, pathname)
+		}
+	}
+
+	if err := rt.load(rt.Cache(), pathnames); err != nil {
+		errs = append(errs, err.(Errors)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func matchPatterns(patterns []string, pathname string) (bool, error) {
+	if len(patterns) == 0 {
+		return true, nil
+	}
+
+	for _, pattern := range patterns {
+		name := pathname
+		if !strings.ContainsRune(pattern, filepath.Separator) {
+			name = filepath.Base(pathname)
+		}
+		if ok, err := filepath.Match(pattern, name); err != nil {
+			return false, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		} else if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// session holds the states of the preprocessing for a single render
+type session struct {
+	t     xTemplate
+	cache Cache
+	// files that preprocessed in this session. it is used to avoid loading
+	// the same file twice even if the cache is disabled.
+	memo map[string]*File
+	// pathnames of the files being preprocessed in order
+	stack []string
+}
+
+func newSession(t xTemplate, cache Cache) *session {
+	return &session{
+		t:     t,
+		cache: cache,
+		memo:  make(map[string]*File),
+	}
+}
+
+// RenderOption changes the behavior of the rendering
+type RenderOption func(o *renderOptions)
+
+type renderOptions struct {
+	layout   string
+	cacheKey string
+}
+
+func newRenderOptions(opts []RenderOption) *renderOptions {
+	o := &renderOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithLayout renders the template with the specified layout instead of the
+// layout declared in the template. each combination of the template and the
+// layout is cached separately.
+func WithLayout(name string) RenderOption {
+	return func(o *renderOptions) {
+		if name != "" {
+			o.layout = filepath.Clean(name)
+		}
+	}
+}
+
+// layoutKey returns the cache key of the template rendered with the layout
+func layoutKey(pathname, layout string) string {
+	return pathname + "\x00" + layout
+}
+
+// preprocessLayout preprocesses the template with the specified layout
+// instead of the layout of the template. it is cached separately from the
+// template, and will be uncached when the template or the layout is uncached.
+func (rt *Runtime) preprocessLayout(s *session, pathname, layout string) (*File, error) {
+	t, cache := s.t, s.cache
+	key := layoutKey(pathname, layout)
+	f := cache.Get(key)
+	if f != nil && f.t == t {
 		return f, nil
+	} else if f = s.memo[key]; f != nil {
+		return f, nil
+	}
+
+	base, err := rt.preprocess(s, pathname)
+	if err != nil {
+		return nil, err
+	}
+	lf, err := rt.preprocess(s, layout)
+	if err != nil {
+		return nil, &PreprocessError{
+			Name:   pathname,
+			Action: "layout",
+			Value:  layout,
+			Err:    err,
+		}
+	}
+
+	f = createFile(cache, t, pathname)
+	f.key = key
+	f.layout = lf
+	f.meta = base.meta
+	f.text = base.text
+	children := base.children()
+	includes := make(map[string]*File, len(children))
+	for _, c := range children {
+		includes[c.name] = c
+		f.addChild(c)
+	}
+	if err = t.Parse(f, f.text, lf, includes); err != nil {
+		return nil, err
+	}
+	base.addParent(f)
+	s.memo[key] = f
+	cache.Set(key, f)
+
+	return f, nil
+}
+
+// CycleError is returned when the template depends on itself through the
+// layout or template actions. Chain is the pathnames of the templates that
+// form the cycle, it starts and ends with the same pathname.
+type CycleError struct {
+	Chain []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf(
+		"cannot parse %q recursively: %s",
+		e.Chain[len(e.Chain)-1], strings.Join(e.Chain, " -> "),
+	)
+}
+
+var ErrLayoutTwice = errors.New("'layout' action cannot be performed twice")
+var ErrOptionalLayout = errors.New("'layout' action cannot be optional")
+
+// PreprocessError is the error that occurred while preprocessing the template
+// associated by the action at the line of the file.
+type PreprocessError struct {
+	Name   string
+	Line   int
+	Action string
+	Value  string
+	Err    error
+}
+
+func (e *PreprocessError) Error() string {
+	return fmt.Sprintf("could not preprocess {{%s %q}} in %q: %v", e.Action, e.Value, e.Name, e.Err)
+}
+
+func (e *PreprocessError) Unwrap() error {
+	return e.Err
+}
+
+func (rt *Runtime) preprocess(s *session, pathname string) (*File, error) {
+	// get cached template that parsed by t
+	t, cache := s.t, s.cache
+	f := cache.Get(pathname)
+	if f != nil && f.t == t && !f.missing {
+		return f, nil
+	} else if f = s.memo[pathname]; f != nil && !f.missing {
+		return f, nil
+	} else if _, ok := cache.(*FrozenCache); ok {
+		return nil, fmt.Errorf("template %q is not loaded: %w", pathname, ErrFrozen)
 	}
 
 	// refuse recursive parsing
-	if _, exists := cref[pathname]; exists {
-		return nil, fmt.Errorf("cannot parse %q recursively", pathname)
+	for i, name := range s.stack {
+		if name == pathname {
+			chain := append(append([]string{}, s.stack[i:]...), pathname)
+			return nil, &CycleError{Chain: chain}
+		}
 	}
-	cref[pathname] = struct{}{}
+	s.stack = append(s.stack, pathname)
+	defer func() {
+		s.stack = s.stack[:len(s.stack)-1]
+	}()
 
 	// read file
 	buf, err := rt.readfn(pathname)
 	if err != nil {
 		return nil, err
 	}
+	var fm FrontMatter
+	if rt.frontMatter {
+		if fm, buf, err = parseFrontMatter(buf); err != nil {
+			return nil, fmt.Errorf("invalid front matter in %q: %w", pathname, err)
+		}
+	}
 
 	// lookup associated templates
-	f = createFile(rt.cache, pathname)
+	f = createFile(cache, t, pathname)
+	f.meta = fm
 	var layout *File
 	var includes = make(map[string]*File)
 	var cur int
@@ -81,18 +476,35 @@ func (rt *Runtime) preprocess(t xTemplate, pathname string, cref map[string]stru
 		cur = m[1]
 		// extract action "value" pair
 		act := string(buf[m[4]:m[5]])
-		val := filepath.Clean(string(buf[m[6]:m[7]]))
+		val := cleanIncludeName(string(buf[m[6]:m[7]]))
+
+		newError := func(err error) error {
+			return &PreprocessError{
+				Name:   pathname,
+				Line:   bytes.Count(buf[:m[2]], []byte("\n")) + 1,
+				Action: act,
+				Value:  val,
+				Err:    err,
+			}
+		}
 
 		// load layout template
 		isLayout := act == "layout"
 		if isLayout && layout != nil {
-			return nil, fmt.Errorf("'layout' action cannot be performed twice")
+			return nil, newError(ErrLayoutTwice)
+		} else if isLayout && isOptionalInclude(val) {
+			return nil, newError(ErrOptionalLayout)
 		}
 
 		// parse associated template
-		af, err := rt.preprocess(t, val, cref)
+		name, af, missing, err := rt.resolveInclude(s, val)
 		if err != nil {
-			return nil, fmt.Errorf("could not preprocess {{%s %q}} in %q: %v", act, val, pathname, err)
+			return nil, newError(err)
+		}
+		// the missing candidates are tracked to be uncached when created
+		for _, mf := range missing {
+			f.addChild(mf)
+			mf.addParent(f)
 		}
 
 		if isLayout {
@@ -102,7 +514,12 @@ func (rt *Runtime) preprocess(t xTemplate, pathname string, cref map[string]stru
 			// update cursor and index
 			cur = m[0]
 		} else {
-			includes[val] = af
+			if name != string(buf[m[6]:m[7]]) {
+				// replace the name with the resolved name
+				buf = append(buf[:m[6]], append([]byte(name), buf[m[7]:]...)...)
+				cur += len(name) - (m[7] - m[6])
+			}
+			includes[name] = af
 			f.addChild(af)
 		}
 		af.addParent(f)
@@ -110,20 +527,209 @@ func (rt *Runtime) preprocess(t xTemplate, pathname string, cref map[string]stru
 		m = reTemplateAction.FindSubmatchIndex(buf[cur:])
 	}
 
-	delete(cref, pathname)
-	err = t.Parse(f, string(buf), layout, includes)
+	// load layout template specified by front matter. it is validated like
+	// the 'layout' action.
+	if val := fm.Layout(); val != "" {
+		val = cleanIncludeName(val)
+		newError := func(err error) error {
+			return &PreprocessError{
+				Name:   pathname,
+				Line:   1,
+				Action: "layout",
+				Value:  val,
+				Err:    err,
+			}
+		}
+		if layout != nil {
+			return nil, newError(ErrLayoutTwice)
+		} else if isOptionalInclude(val) {
+			return nil, newError(ErrOptionalLayout)
+		}
+		_, af, missing, err := rt.resolveInclude(s, val)
+		if err != nil {
+			return nil, newError(err)
+		}
+		for _, mf := range missing {
+			f.addChild(mf)
+			mf.addParent(f)
+		}
+		layout = af
+		af.addParent(f)
+	}
+
+	f.layout = layout
+	f.text = string(buf)
+	err = t.Parse(f, f.text, layout, includes)
 	if err != nil {
 		return nil, err
 	}
-	rt.cache.Set(f.name, f)
+	s.memo[f.name] = f
+	if old := cache.Get(f.name); old != nil && old.missing {
+		// the templates that include the file optionally must be uncached
+		// since the file has been created
+		old.Uncache()
+	} else if old != nil && old.t != t {
+		// the file parsed by the other template is replaced
+		f.inherit(old)
+	}
+	cache.Set(f.name, f)
 
 	return f, nil
 }
 
-func (rt *Runtime) RenderText(w io.Writer, pathname string, data map[string]interface{}) error {
-	return rt.text.Render(w, filepath.Clean(pathname), data)
+// optionalPrefix is the prefix of the name of the optional include
+const optionalPrefix = "@?"
+
+// fallbackSep separates the candidates of the include
+const fallbackSep = "|"
+
+// isOptionalInclude returns true if any candidate of the include is optional
+func isOptionalInclude(name string) bool {
+	for _, v := range strings.Split(name, fallbackSep) {
+		if strings.HasPrefix(v, optionalPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanIncludeName cleans each candidate of the include name
+func cleanIncludeName(name string) string {
+	list := strings.Split(name, fallbackSep)
+	for i, v := range list {
+		list[i] = filepath.Clean(v)
+	}
+	return strings.Join(list, fallbackSep)
+}
+
+// resolveInclude preprocesses the first template that exists in the
+// candidates separated by "|" and returns its name. the candidates prefixed
+// with "@?" are optional, and the empty template is returned if the last
+// candidate is optional and none of the candidates exist. the placeholders of
+// the missing candidates before the resolved template are also returned to
+// track them as the dependencies.
+func (rt *Runtime) resolveInclude(s *session, val string) (string, *File, []*File, error) {
+	list := strings.Split(val, fallbackSep)
+	for _, name := range list {
+		if !strings.HasPrefix(name, "@") {
+			return "", nil, nil, fmt.Errorf("invalid include name %q: must be prefixed with \"@\"", name)
+		}
+	}
+
+	var missing []*File
+	for i, name := range list {
+		last := i == len(list)-1
+		optional := strings.HasPrefix(name, optionalPrefix)
+		if optional {
+			name = "@" + name[len(optionalPrefix):]
+		}
+
+		if last && !optional {
+			f, err := rt.preprocess(s, name)
+			return name, f, missing, err
+		}
+		f, err := rt.preprocessOptional(s, name)
+		if err != nil {
+			return "", nil, nil, err
+		} else if !f.missing || last {
+			return name, f, missing, nil
+		}
+		missing = append(missing, f)
+	}
+	panic("unreachable")
+}
+
+// isMissing returns true if err reports that the template itself does not
+// exist. the loaders may wrap the error. the errors of the templates that it
+// depends on are wrapped by PreprocessError and not reported.
+func isMissing(err error) bool {
+	var pe *PreprocessError
+	return errors.Is(err, os.ErrNotExist) && !errors.As(err, &pe)
+}
+
+// preprocessOptional preprocesses the template like preprocess, but returns
+// the empty template if the template does not exist. the empty template is
+// cached to track the templates that include it.
+func (rt *Runtime) preprocessOptional(s *session, pathname string) (*File, error) {
+	t, cache := s.t, s.cache
+	if f := cache.Get(pathname); f != nil && f.t == t && f.missing {
+		return f, nil
+	} else if f = s.memo[pathname]; f != nil && f.missing {
+		return f, nil
+	}
+
+	f, err := rt.preprocess(s, pathname)
+	if err == nil || !isMissing(err) {
+		return f, err
+	}
+
+	f = createFile(cache, t, pathname)
+	f.missing = true
+	if err = t.Parse(f, "", nil, nil); err != nil {
+		return nil, err
+	}
+	s.memo[pathname] = f
+	cache.Set(pathname, f)
+
+	return f, nil
+}
+
+// SetBus subscribes to the bus to uncache the templates that published by
+// the other runtimes, and publishes the names passed to Uncache.
+func (rt *Runtime) SetBus(bus Bus) error {
+	if err := bus.Subscribe(rt.uncache); err != nil {
+		return err
+	}
+	rt.bus = bus
+	return nil
+}
+
+func (rt *Runtime) uncache(pathname string) {
+	if f := rt.Cache().Get(pathname); f != nil {
+		f.Uncache()
+	}
+}
+
+// Uncache removes the template and its dependents from the cache, and
+// publishes its name to the bus if set.
+func (rt *Runtime) Uncache(pathname string) error {
+	pathname = filepath.Clean(pathname)
+	rt.uncache(pathname)
+	if rt.bus != nil {
+		return rt.bus.Publish(pathname)
+	}
+	return nil
+}
+
+// SetFrontMatter enables to parse the front matter at the beginning of the
+// templates. it is disabled by default because the text templates such as
+// YAML can start with "---". it must be set before loading the templates.
+func (rt *Runtime) SetFrontMatter(enabled bool) {
+	rt.frontMatter = enabled
+}
+
+// FrontMatter returns the front matter of the template
+func (rt *Runtime) FrontMatter(pathname string) (FrontMatter, error) {
+	pathname = filepath.Clean(pathname)
+	t := rt.templateFor(pathname)
+	f, err := rt.preprocess(newSession(t, rt.Cache()), pathname)
+	if err != nil {
+		return nil, err
+	}
+	return f.meta, nil
+}
+
+// Render renders the template with html/template if the file has the html
+// extension, otherwise with text/template.
+func (rt *Runtime) Render(w io.Writer, pathname string, data map[string]interface{}, opts ...RenderOption) error {
+	pathname = filepath.Clean(pathname)
+	return rt.templateFor(pathname).Render(w, pathname, data, opts...)
+}
+
+func (rt *Runtime) RenderText(w io.Writer, pathname string, data map[string]interface{}, opts ...RenderOption) error {
+	return rt.text.Render(w, filepath.Clean(pathname), data, opts...)
 }
 
-func (rt *Runtime) RenderHTML(w io.Writer, pathname string, data map[string]interface{}) error {
-	return rt.html.Render(w, filepath.Clean(pathname), data)
+func (rt *Runtime) RenderHTML(w io.Writer, pathname string, data map[string]interface{}, opts ...RenderOption) error {
+	return rt.html.Render(w, filepath.Clean(pathname), data, opts...)
 }
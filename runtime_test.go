@@ -2,9 +2,14 @@ package templatex
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"syscall"
 	"testing"
 
@@ -30,6 +35,57 @@ func TestDefaultReadFunc(t *testing.T) {
 	assert.Equal(t, []byte("hello world!"), b)
 }
 
+func TestDefaultListFunc(t *testing.T) {
+	// test that returns the files under the current directory
+	list, err := DefaultListFunc()
+	assert.NoError(t, err)
+	assert.Contains(t, list, "runtime.go")
+	assert.Contains(t, list, filepath.Join("builtins", "funcmap.go"))
+
+	// test that hidden files are not contained
+	for _, pathname := range list {
+		assert.NotRegexp(t, `(^|/)\.`, pathname)
+	}
+}
+
+func TestDirReadFunc_DirListFunc(t *testing.T) {
+	// setup
+	rootdir, err := ioutil.TempDir("", "templatex")
+	assert.NoError(t, err)
+	defer os.RemoveAll(rootdir)
+	for pathname, content := range map[string]string{
+		"index.html":       "index",
+		"sub/page.html":    "page",
+		".hidden":          "hidden",
+		".git/config":      "config",
+		"sub/.hidden.html": "hidden",
+	} {
+		pathname = filepath.Join(rootdir, pathname)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(pathname), 0755))
+		assert.NoError(t, ioutil.WriteFile(pathname, []byte(content), 0644))
+	}
+
+	// test that read the file under the root directory
+	readfn := DirReadFunc(rootdir)
+	b, err := readfn("sub/page.html")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("page"), b)
+
+	// test that cannot read the file outside of the root directory
+	b, err = readfn("../" + filepath.Base(rootdir) + "/index.html")
+	assert.True(t, os.IsNotExist(err))
+	assert.Nil(t, b)
+
+	// test that returns the files relative to the root directory
+	list, err := DirListFunc(rootdir)()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"index.html", filepath.Join("sub", "page.html")}, list)
+
+	// test that returns an error if the root directory does not exist
+	_, err = DirListFunc(filepath.Join(rootdir, "unknown"))()
+	assert.True(t, os.IsNotExist(err))
+}
+
 func TestNew(t *testing.T) {
 	tpl := New()
 
@@ -54,6 +110,20 @@ func TestNewEx(t *testing.T) {
 	assert.Equal(t, fmt.Sprintf("%p", readfn), fmt.Sprintf("%p", tpl.readfn))
 	// test that funcs is equal to funcs
 	assert.Equal(t, fmt.Sprintf("%#v", funcs), fmt.Sprintf("%#v", tpl.funcs))
+
+	// test that panics if funcs contains the name of the runtime function
+	for _, name := range []string{"include", "component", "body", "push", "stack", "set", "get", "incr", "append", "cache", "props", "super"} {
+		func() {
+			defer func() {
+				err, ok := recover().(error)
+				assert.True(t, ok, name)
+				assert.EqualError(t, err, fmt.Sprintf("function %q cannot be defined: the name is reserved by the runtime", name))
+			}()
+			NewEx(readfn, NewNopCache(), map[string]interface{}{
+				name: func() string { return "" },
+			})
+		}()
+	}
 }
 
 func TestRuntime_RenderHTML(t *testing.T) {
@@ -447,3 +517,531 @@ func TestRuntime_RenderText(t *testing.T) {
 	assert.Contains(t, err.Error(), `@err_include.html:3: function "UnknownFunc" not defined`)
 
 }
+
+func TestRuntime_Swap(t *testing.T) {
+	// setup
+	rootdir := "/root/dir/"
+	files := map[string]string{
+		"/root/dir/@layout.html":  `[{{template "content" .}}|{{template "@include.html"}}]`,
+		"/root/dir/@include.html": `{{define "@include.html"}}v1{{end}}`,
+		"/root/dir/index.html":    `{{define "content"}}hello {{.World}}{{end}}{{layout "@layout.html"}}`,
+		"/root/dir/index.txt":     `hello {{.World}} {{template "@include.html"}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[filepath.Join(rootdir, pathname)]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	rt := NewEx(readfn, NewMapCache(), builtins.FuncMap())
+	data := map[string]interface{}{
+		"World": "<world>",
+	}
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt.RenderHTML(b, "index.html", data))
+	assert.Equal(t, "[hello &lt;world&gt;|v1]", b.String())
+	old := rt.Cache()
+
+	// test that prepare a new template set without changing the current set
+	files["/root/dir/@layout.html"] = `({{template "content" .}}|{{template "@include.html"}})`
+	files["/root/dir/@include.html"] = `{{define "@include.html"}}v2{{end}}`
+	cache, err := rt.Prepare("index.html", "index.txt")
+	assert.NoError(t, err)
+	assert.NotNil(t, cache.Get("index.html"))
+	assert.NotNil(t, cache.Get("index.txt"))
+	assert.NotNil(t, cache.Get("@layout.html"))
+	assert.NotNil(t, cache.Get("@include.html"))
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "index.html", data))
+	assert.Equal(t, "[hello &lt;world&gt;|v1]", b.String())
+
+	// test that swap the template set
+	prev, err := rt.Swap(cache)
+	assert.NoError(t, err)
+	assert.Equal(t, old, prev)
+	assert.Equal(t, cache, rt.Cache())
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "index.html", data))
+	assert.Equal(t, "(hello &lt;world&gt;|v2)", b.String())
+	b.Reset()
+	assert.NoError(t, rt.RenderText(b, "index.txt", data))
+	assert.Equal(t, "hello <world> v2", b.String())
+
+	// test that the old set is not affected by the files of the new set
+	old.Get("@include.html").Uncache()
+	assert.Nil(t, old.Get("index.html"))
+	assert.NotNil(t, cache.Get("index.html"))
+
+	// test that the template parsed by the other renderer is not used
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "index.txt", data))
+	assert.Equal(t, "hello &lt;world&gt; v2", b.String())
+
+	// test that returns an error if failed to prepare the template
+	_, err = rt.Prepare("index.html", "unknown.html")
+	assert.IsType(t, Errors{}, err)
+	assert.Len(t, err, 1)
+	assert.Equal(t, syscall.ENOENT, errors.Unwrap(err.(Errors)[0]))
+	assert.Regexp(t, `could not load "unknown.html"`, err)
+}
+
+func TestRuntime_Preload(t *testing.T) {
+	// setup
+	rootdir := "/root/dir/"
+	files := map[string]string{
+		"/root/dir/@layout.html":         `[{{template "content" .}}]`,
+		"/root/dir/@include.html":        `{{define "@include.html"}}included{{end}}`,
+		"/root/dir/index.html":           `{{define "content"}}hello {{template "@include.html"}}{{end}}{{layout "@layout.html"}}`,
+		"/root/dir/mail.txt":             `hello {{.World}}`,
+		"/root/dir/sub/page.html":        `{{template "@include.html"}}`,
+		"/root/dir/invalid/parse.html":   `hello {{.World}`,
+		"/root/dir/invalid/include.html": `{{template "@unknown.html"}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[filepath.Join(rootdir, pathname)]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	listfn := func() ([]string, error) {
+		var list []string
+		for pathname := range files {
+			list = append(list, strings.TrimPrefix(pathname, rootdir))
+		}
+		sort.Strings(list)
+		return list, nil
+	}
+	create := func() (*Runtime, Cache) {
+		cache := NewMapCache()
+		rt := NewEx(readfn, cache, builtins.FuncMap())
+		rt.SetListFunc(listfn)
+		return rt, cache
+	}
+
+	// test that preload the files matched to the patterns
+	rt, cache := create()
+	assert.NoError(t, rt.Preload("*.txt", "sub/*"))
+	assert.NotNil(t, cache.Get("mail.txt"))
+	assert.NotNil(t, cache.Get("sub/page.html"))
+	assert.NotNil(t, cache.Get("@include.html"))
+	assert.Nil(t, cache.Get("index.html"))
+
+	// test that the files are preprocessed by the renderers for their extension
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt.RenderText(b, "mail.txt", map[string]interface{}{
+		"World": "<world>",
+	}))
+	assert.Equal(t, "hello <world>", b.String())
+	assert.Equal(t, rt.text, cache.Get("mail.txt").t)
+	assert.Equal(t, rt.html, cache.Get("sub/page.html").t)
+
+	// test that returns all errors
+	rt, cache = create()
+	err := rt.Preload()
+	assert.IsType(t, Errors{}, err)
+	assert.Len(t, err, 2)
+	assert.Regexp(t, `could not load "invalid/include.html": could not preprocess {{template "@unknown.html"}}`, err.(Errors)[0])
+	assert.Regexp(t, `could not load "invalid/parse.html": template: invalid/parse.html:1:`, err.(Errors)[1])
+	assert.NotNil(t, cache.Get("index.html"))
+	assert.NotNil(t, cache.Get("@layout.html"))
+	assert.Nil(t, cache.Get("invalid/parse.html"))
+
+	// test that returns an error if the pattern is invalid
+	rt, _ = create()
+	assert.Regexp(t, `invalid pattern "\[": syntax error in pattern`, rt.Preload("["))
+
+	// test that returns an error of ListFunc
+	rt, _ = create()
+	rt.SetListFunc(func() ([]string, error) {
+		return nil, syscall.EACCES
+	})
+	assert.Equal(t, syscall.EACCES, rt.Preload())
+}
+
+type testCache struct {
+	Cache
+}
+
+func TestRuntime_Freeze(t *testing.T) {
+	// setup
+	rootdir := "/root/dir/"
+	files := map[string]string{
+		"/root/dir/@include.html": `{{define "@include.html"}}included{{end}}`,
+		"/root/dir/index.html":    `hello {{template "@include.html"}}`,
+		"/root/dir/other.html":    `other`,
+	}
+	nread := 0
+	readfn := func(pathname string) ([]byte, error) {
+		nread++
+		if s, ok := files[filepath.Join(rootdir, pathname)]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	rt := NewEx(readfn, NewMapCache(), builtins.FuncMap())
+	rt.SetListFunc(func() ([]string, error) {
+		return []string{"@include.html", "index.html"}, nil
+	})
+	assert.NoError(t, rt.Preload())
+	assert.False(t, rt.IsFrozen())
+
+	// test that the cache is replaced with the read-only cache
+	assert.NoError(t, rt.Freeze())
+	assert.True(t, rt.IsFrozen())
+	cache := rt.Cache()
+	assert.IsType(t, &FrozenCache{}, cache)
+	assert.NotNil(t, cache.Get("index.html"))
+	assert.NotNil(t, cache.Get("@include.html"))
+
+	// test that render the preloaded template without loader
+	nread = 0
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt.RenderHTML(b, "index.html", nil))
+	assert.Equal(t, "hello included", b.String())
+	assert.Equal(t, 0, nread)
+
+	// test that returns ErrFrozen if the template is not preloaded
+	err := rt.RenderHTML(b, "other.html", nil)
+	assert.True(t, errors.Is(err, ErrFrozen))
+	assert.Equal(t, `template "other.html" is not loaded: runtime is frozen`, err.Error())
+	err = rt.RenderText(b, "index.html", nil)
+	assert.True(t, errors.Is(err, ErrFrozen))
+	assert.Equal(t, 0, nread)
+
+	// test that frozen cache cannot be changed
+	assert.NoError(t, rt.Uncache("index.html"))
+	assert.NotNil(t, cache.Get("index.html"))
+	cache.Set("other.html", cache.Get("index.html"))
+	assert.Nil(t, cache.Get("other.html"))
+
+	// test that the swapped cache will be frozen
+	newCache, err := rt.Prepare("other.html")
+	assert.NoError(t, err)
+	_, err = rt.Swap(newCache)
+	assert.NoError(t, err)
+	assert.IsType(t, &FrozenCache{}, rt.Cache())
+	assert.NotNil(t, rt.Cache().Get("other.html"))
+	assert.Nil(t, rt.Cache().Get("index.html"))
+
+	// test that returns an error if the cache is NopCache since nothing is
+	// loaded
+	_, err = rt.Swap(NewNopCache())
+	assert.EqualError(t, err, "templatex.NopCache cannot be frozen: nothing is loaded")
+	assert.NotNil(t, rt.Cache().Get("other.html"))
+
+	// test that returns an error if the cache cannot list its files
+	_, err = rt.Swap(testCache{})
+	assert.Regexp(t, `templatex.testCache cannot be frozen`, err)
+	rt = NewEx(readfn, testCache{}, builtins.FuncMap())
+	assert.Regexp(t, `templatex.testCache cannot be frozen`, rt.Freeze())
+	assert.False(t, rt.IsFrozen())
+	rt = NewEx(readfn, NewNopCache(), builtins.FuncMap())
+	assert.EqualError(t, rt.Freeze(), "templatex.NopCache cannot be frozen: nothing is loaded")
+	assert.False(t, rt.IsFrozen())
+}
+
+func TestRuntime_RenderWithoutCache(t *testing.T) {
+	// setup
+	rootdir := "/root/dir/"
+	files := map[string]string{
+		"/root/dir/@include.html": `{{define "@include.html"}}included{{end}}`,
+		"/root/dir/@layout.html":  `{{template "@include.html"}}: {{template "content" .}}`,
+		"/root/dir/index.html":    `{{define "content"}}hello {{template "@include.html"}}{{end}}{{layout "@layout.html"}}`,
+	}
+	nread := map[string]int{}
+	readfn := func(pathname string) ([]byte, error) {
+		nread[pathname]++
+		if s, ok := files[filepath.Join(rootdir, pathname)]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	rt := NewEx(readfn, NewNopCache(), builtins.FuncMap())
+
+	// test that each file is loaded only once per render
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt.RenderHTML(b, "index.html", nil))
+	assert.Equal(t, "included: hello included", b.String())
+	assert.Equal(t, map[string]int{
+		"index.html":    1,
+		"@layout.html":  1,
+		"@include.html": 1,
+	}, nread)
+
+	// test that files are loaded again for each render
+	b.Reset()
+	assert.NoError(t, rt.RenderText(b, "index.html", nil))
+	assert.Equal(t, "included: hello included", b.String())
+	assert.Equal(t, map[string]int{
+		"index.html":    2,
+		"@layout.html":  2,
+		"@include.html": 2,
+	}, nread)
+}
+
+func TestRuntime_Render(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"index.html": `hello {{.World}}`,
+		"index.txt":  `hello {{.World}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	rt := NewEx(readfn, NewMapCache(), builtins.FuncMap())
+	data := map[string]interface{}{
+		"World": "<world>",
+	}
+
+	// test that render the html file with html/template
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt.Render(b, "./index.html", data))
+	assert.Equal(t, "hello &lt;world&gt;", b.String())
+
+	// test that render the other file with text/template
+	b.Reset()
+	assert.NoError(t, rt.Render(b, "index.txt", data))
+	assert.Equal(t, "hello <world>", b.String())
+}
+
+func TestRuntime_UncacheAcrossRenderers(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@nav.html":  `{{define "@nav.html"}}v1{{end}}`,
+		"index.html": `html {{template "@nav.html"}}`,
+		"index.txt":  `text {{template "@nav.html"}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	cache := NewMapCache()
+	rt := NewEx(readfn, cache, builtins.FuncMap())
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt.RenderHTML(b, "index.html", nil))
+	assert.Equal(t, "html v1", b.String())
+
+	// test that the dependents of the file parsed by the other renderer are
+	// uncached after the file is parsed again
+	b.Reset()
+	assert.NoError(t, rt.RenderText(b, "index.txt", nil))
+	assert.Equal(t, "text v1", b.String())
+	files["@nav.html"] = `{{define "@nav.html"}}v2{{end}}`
+	assert.NoError(t, rt.Uncache("@nav.html"))
+	assert.Nil(t, cache.Get("index.html"))
+	assert.Nil(t, cache.Get("index.txt"))
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "index.html", nil))
+	assert.Equal(t, "html v2", b.String())
+}
+
+func TestRuntime_ConcurrentUncache(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@layout.html": `<main>{{template "content" .}}</main>`,
+		"@nav.html":    `{{define "@nav.html"}}nav{{end}}`,
+		"@item.html":   `item`,
+		"index.html":   `{{layout "@layout.html"}}{{define "content"}}{{template "@nav.html"}} {{include "@item.html"}}{{end}}`,
+		"index.txt":    `{{template "@nav.html"}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	rt := NewEx(readfn, NewMapCache(), builtins.FuncMap())
+
+	// test that the templates can be uncached while rendering
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				b := bytes.NewBuffer(nil)
+				if i%2 == 0 {
+					assert.NoError(t, rt.Render(b, "index.html", nil))
+					assert.Equal(t, "<main>nav item</main>", b.String())
+				} else {
+					assert.NoError(t, rt.Render(b, "index.txt", nil))
+					assert.Equal(t, "nav", b.String())
+				}
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 50; j++ {
+			for _, name := range []string{"@nav.html", "@layout.html", "@item.html"} {
+				assert.NoError(t, rt.Uncache(name))
+			}
+		}
+	}()
+	wg.Wait()
+
+	// test that the dependencies can be added while uncaching
+	cache := NewMapCache()
+	f := createFile(cache, rt.html, "@shared.html")
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				p := createFile(cache, rt.html, fmt.Sprintf("page%d-%d.html", i, j))
+				f.addParent(p)
+				p.addChild(f)
+				f.Uncache()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, f.parents(), 400)
+}
+
+func TestRuntime_RenderWithLayout(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@layout.html":  `<p>{{template "content" .}}</p>`,
+		"@mobile.html":  `<div>{{template "content" .}} {{template "@footer.html"}}</div>`,
+		"@footer.html":  `{{define "@footer.html"}}footer{{end}}`,
+		"@include.html": `{{define "@include.html"}}v1{{end}}`,
+		"index.html":    `{{define "content"}}hello {{template "@include.html"}}{{end}}{{layout "@layout.html"}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	cache := NewMapCache()
+	rt := NewEx(readfn, cache, builtins.FuncMap())
+
+	// test that render the template with the declared layout
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt.Render(b, "index.html", nil))
+	assert.Equal(t, "<p>hello v1</p>", b.String())
+
+	// test that render the template with the specified layout
+	b.Reset()
+	assert.NoError(t, rt.Render(b, "index.html", nil, WithLayout("@mobile.html")))
+	assert.Equal(t, "<div>hello v1 footer</div>", b.String())
+
+	// test that each combination is cached separately
+	assert.NotNil(t, cache.Get("index.html"))
+	assert.NotNil(t, cache.Get(layoutKey("index.html", "@mobile.html")))
+	b.Reset()
+	assert.NoError(t, rt.Render(b, "index.html", nil))
+	assert.Equal(t, "<p>hello v1</p>", b.String())
+
+	// test that empty layout name renders with the declared layout
+	b.Reset()
+	assert.NoError(t, rt.Render(b, "index.html", nil, WithLayout("")))
+	assert.Equal(t, "<p>hello v1</p>", b.String())
+
+	// test that the combination is uncached when the include is uncached
+	files["@include.html"] = `{{define "@include.html"}}v2{{end}}`
+	assert.NoError(t, rt.Uncache("@include.html"))
+	assert.Nil(t, cache.Get(layoutKey("index.html", "@mobile.html")))
+	b.Reset()
+	assert.NoError(t, rt.Render(b, "index.html", nil, WithLayout("@mobile.html")))
+	assert.Equal(t, "<div>hello v2 footer</div>", b.String())
+
+	// test that the combination is uncached when the layout is uncached
+	files["@mobile.html"] = `<section>{{template "content" .}}</section>`
+	assert.NoError(t, rt.Uncache("@mobile.html"))
+	assert.NotNil(t, cache.Get("index.html"))
+	b.Reset()
+	assert.NoError(t, rt.Render(b, "index.html", nil, WithLayout("@mobile.html")))
+	assert.Equal(t, "<section>hello v2</section>", b.String())
+
+	// test that the graph contains the combination as the template
+	g, err := rt.Graph()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"@footer.html", "@include.html", "@layout.html", "@mobile.html", "index.html"}, g.Nodes)
+	assert.Equal(t, []string{"index.html"}, g.Dependents("@mobile.html"))
+
+	// test that returns an error if the layout does not exist
+	b.Reset()
+	err = rt.Render(b, "index.html", nil, WithLayout("@unknown.html"))
+	var perr *PreprocessError
+	assert.True(t, errors.As(err, &perr))
+	assert.Equal(t, "layout", perr.Action)
+	assert.Equal(t, "@unknown.html", perr.Value)
+}
+
+func TestRuntime_LayoutChain(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@base.html":    `<html>{{template "@nav.html"}}{{block "content" .}}base{{end}}</html>`,
+		"@nav.html":     `{{define "@nav.html"}}<nav>v1</nav>{{end}}`,
+		"@section.html": `{{define "content"}}<section>{{block "body" .}}section{{end}}</section>{{end}}{{layout "@base.html"}}`,
+		"index.html":    `{{define "body"}}hello {{.World}}{{end}}{{layout "@section.html"}}`,
+		"cycle.html":    `{{layout "@cycle_a.html"}}`,
+		"@cycle_a.html": `{{layout "@cycle_b.html"}}`,
+		"@cycle_b.html": `{{layout "@cycle_a.html"}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	cache := NewMapCache()
+	rt := NewEx(readfn, cache, builtins.FuncMap())
+	data := map[string]interface{}{
+		"World": "world",
+	}
+	render := func(name string) string {
+		b := bytes.NewBuffer(nil)
+		assert.NoError(t, rt.RenderHTML(b, name, data))
+		return b.String()
+	}
+
+	// test that render the template with the top of the layout chain
+	assert.Equal(t, "<html><nav>v1</nav><section>hello world</section></html>", render("index.html"))
+	assert.Equal(t, "<html><nav>v1</nav><section>section</section></html>", render("@section.html"))
+
+	// test that the template depends on all the layouts and their includes
+	g, err := rt.Graph()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"@base.html", "@nav.html", "@section.html"}, g.Dependencies("index.html"))
+	for _, name := range []string{"@base.html", "@nav.html", "@section.html"} {
+		assert.Contains(t, cache.Get(name).parent, "index.html")
+	}
+
+	// test that the template is uncached when the include of the top layout
+	// is uncached
+	files["@nav.html"] = `{{define "@nav.html"}}<nav>v2</nav>{{end}}`
+	assert.NoError(t, rt.Uncache("@nav.html"))
+	assert.Nil(t, cache.Get("index.html"))
+	assert.Equal(t, "<html><nav>v2</nav><section>hello world</section></html>", render("index.html"))
+
+	// test that the template is uncached when the intermediate layout is
+	// uncached, and the top layout is kept
+	files["@section.html"] = `{{define "content"}}<main>{{block "body" .}}{{end}}</main>{{end}}{{layout "@base.html"}}`
+	assert.NoError(t, rt.Uncache("@section.html"))
+	assert.Nil(t, cache.Get("index.html"))
+	assert.NotNil(t, cache.Get("@base.html"))
+	assert.Equal(t, "<html><nav>v2</nav><main>hello world</main></html>", render("index.html"))
+
+	// test that the template is uncached when the top layout is uncached
+	files["@base.html"] = `<body>{{block "content" .}}{{end}}</body>`
+	assert.NoError(t, rt.Uncache("@base.html"))
+	assert.Nil(t, cache.Get("index.html"))
+	assert.Nil(t, cache.Get("@section.html"))
+	assert.Equal(t, "<body><main>hello world</main></body>", render("index.html"))
+
+	// test that returns an error that shows the chain of the layout cycle
+	err = rt.RenderHTML(bytes.NewBuffer(nil), "cycle.html", data)
+	var cerr *CycleError
+	assert.True(t, errors.As(err, &cerr))
+	assert.Equal(t, []string{"@cycle_a.html", "@cycle_b.html", "@cycle_a.html"}, cerr.Chain)
+	assert.Contains(t, err.Error(), `cannot parse "@cycle_a.html" recursively: @cycle_a.html -> @cycle_b.html -> @cycle_a.html`)
+}
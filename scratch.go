@@ -0,0 +1,33 @@
+package templatex
+
+import "github.com/mah0x211/templatex/builtins"
+
+// scratch returns the key-value store of the render. it is shared between all
+// templates in the render, and is not shared with the other renders.
+func (x *execution) scratch() *builtins.Scratch {
+	if x.store == nil {
+		x.store = builtins.NewScratch()
+	}
+	return x.store
+}
+
+// set stores the value of key, it emits nothing
+func (x *execution) set(key string, v interface{}) string {
+	x.scratch().Set(key, v)
+	return ""
+}
+
+func (x *execution) get(key string) interface{} {
+	return x.scratch().Get(key)
+}
+
+// incr increments the value of key, and returns the new value
+func (x *execution) incr(key string, n ...int) (int, error) {
+	return x.scratch().Incr(key, n...)
+}
+
+// append appends the values to the list of key, it emits nothing
+func (x *execution) append(key string, v ...interface{}) (string, error) {
+	_, err := x.scratch().Append(key, v...)
+	return "", err
+}
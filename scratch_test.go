@@ -0,0 +1,50 @@
+package templatex
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+
+	"github.com/mah0x211/templatex/builtins"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntime_Scratch(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@layout.html": `<h1>{{get "title"}}</h1>{{template "content" .}}<p>{{get "count"}} figures: {{(get "figures").Join ", "}}</p>`,
+		"@figure.html": `{{define "@figure.html"}}<figure>{{incr "count"}}. {{.}}</figure>{{append "figures" .}}{{end}}`,
+		"index.html": `{{define "content"}}{{set "title" .Title}}` +
+			`{{range .Figures}}{{template "@figure.html" .}}{{end}}` +
+			`{{include "@figure.html" "dynamic"}}{{end}}` +
+			`{{layout "@layout.html"}}`,
+		"invalid.html": `{{set "count" "one"}}{{incr "count"}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	rt := NewEx(readfn, NewMapCache(), builtins.FuncMap())
+
+	// test that the values are shared between the templates in the render
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt.RenderHTML(b, "index.html", map[string]interface{}{
+		"Title":   "<title>",
+		"Figures": []string{"a", "b"},
+	}))
+	assert.Equal(t, `<h1></h1><figure>1. a</figure><figure>2. b</figure><figure>3. dynamic</figure><p>3 figures: a, b, dynamic</p>`, b.String())
+
+	// test that the values are not shared between the renders
+	b.Reset()
+	assert.NoError(t, rt.RenderText(b, "index.html", map[string]interface{}{
+		"Figures": []string{"c"},
+	}))
+	assert.Equal(t, `<h1><no value></h1><figure>1. c</figure><figure>2. dynamic</figure><p>2 figures: c, dynamic</p>`, b.String())
+
+	// test that returns an error if the value cannot be incremented
+	err := rt.RenderHTML(bytes.NewBuffer(nil), "invalid.html", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `value of "count" is not int: string`)
+}
@@ -0,0 +1,268 @@
+package templatex
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SiteManifest is the name of the file that records the digests of the
+// built files in the output directory
+const SiteManifest = ".templatex-build.json"
+
+var DefaultPagePatterns = []string{"*.html", "*.htm"}
+
+type SiteReport struct {
+	Rendered []string
+	Skipped  []string
+	Copied   []string
+}
+
+type siteManifest struct {
+	Files map[string]string `json:"files"`
+	// Deps is the dependencies of the pages found by the last render. they
+	// include the templates loaded by the include and component functions.
+	Deps map[string][]string `json:"deps,omitempty"`
+}
+
+func readSiteManifest(dst string) *siteManifest {
+	m := &siteManifest{}
+	if b, err := ioutil.ReadFile(filepath.Join(dst, SiteManifest)); err == nil {
+		json.Unmarshal(b, m)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string]string)
+	}
+	return m
+}
+
+func (m *siteManifest) write(dst string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dst, SiteManifest), b, 0644)
+}
+
+// isHiddenPath returns true if any element of the pathname is prefixed with
+// "@" or "."
+func isHiddenPath(pathname string) bool {
+	for _, seg := range strings.Split(filepath.ToSlash(pathname), "/") {
+		if strings.HasPrefix(seg, "@") || strings.HasPrefix(seg, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// pageDeps returns the sorted pathnames of the page, its data and the
+// dependencies of f and the extra dependencies.
+func pageDeps(pathname string, f *File, extra []string) []string {
+	list := append([]string{pathname, dataFileOf(pathname)}, NewGraph(f).Dependencies(pathname)...)
+	list = append(list, extra...)
+	sort.Strings(list)
+	deps := list[:0]
+	for i, v := range list {
+		if i == 0 || v != list[i-1] {
+			deps = append(deps, v)
+		}
+	}
+	return deps
+}
+
+func dataFileOf(pathname string) string {
+	return strings.TrimSuffix(pathname, filepath.Ext(pathname)) + ".json"
+}
+
+func writeSiteFile(dst, pathname string, b []byte) error {
+	pathname = filepath.Join(dst, pathname)
+	if err := os.MkdirAll(filepath.Dir(pathname), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(pathname, b, 0644)
+}
+
+// buildOutputs reports whether the pathnames are in the output directories of
+// the previous builds. the output directories are recognized by SiteManifest.
+type buildOutputs struct {
+	readfn ReadFunc
+	dirs   map[string]bool
+}
+
+func (o *buildOutputs) contains(pathname string) bool {
+	for dir := filepath.Dir(pathname); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		found, ok := o.dirs[dir]
+		if !ok {
+			_, err := o.readfn(filepath.Join(dir, SiteManifest))
+			found = err == nil
+			o.dirs[dir] = found
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+func fileExists(pathname string) bool {
+	_, err := os.Stat(pathname)
+	return err == nil
+}
+
+// digest returns the digest of the files. it returns false if any of the
+// files cannot be read.
+func (rt *Runtime) digest(pathnames ...string) (string, bool) {
+	h := sha256.New()
+	for _, pathname := range pathnames {
+		b, err := rt.readfn(pathname)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return "", false
+			}
+			b = nil
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", pathname, len(b))
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+func (rt *Runtime) renderPage(w *bytes.Buffer, s *session, f *File) error {
+	var data map[string]interface{}
+	datafile := dataFileOf(f.name)
+	if b, err := rt.readfn(datafile); err == nil {
+		if err = json.Unmarshal(b, &data); err != nil {
+			return fmt.Errorf("could not decode %q: %w", datafile, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return s.t.execute(s, f, w, data)
+}
+
+// BuildSite renders all the pages that returned by ListFunc and matched to the
+// patterns into the dst directory with the same pathnames. the data of the
+// page is read from the JSON file that has the same name as the page except
+// the extension. the files prefixed with "@" or "." are not rendered, and the
+// other files except the data files are copied as the static assets.
+// the pages that the page and its dependencies have not changed since the
+// last build are skipped. the directories that contain SiteManifest are the
+// outputs of the builds and are skipped, so dst can be under the source
+// directory.
+func (rt *Runtime) BuildSite(dst string, patterns ...string) (*SiteReport, error) {
+	if len(patterns) == 0 {
+		patterns = DefaultPagePatterns
+	}
+	list, err := rt.listfn()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(list)
+
+	var pages, assets []string
+	datafiles := make(map[string]bool)
+	outputs := &buildOutputs{
+		readfn: rt.readfn,
+		dirs:   make(map[string]bool),
+	}
+	for _, pathname := range list {
+		if isHiddenPath(pathname) || outputs.contains(pathname) {
+			continue
+		} else if ok, err := matchPatterns(patterns, pathname); err != nil {
+			return nil, err
+		} else if ok {
+			pages = append(pages, pathname)
+			datafiles[dataFileOf(pathname)] = true
+		} else {
+			assets = append(assets, pathname)
+		}
+	}
+
+	prev := readSiteManifest(dst)
+	manifest := &siteManifest{
+		Files: make(map[string]string),
+		Deps:  make(map[string][]string),
+	}
+	report := &SiteReport{}
+	var errs Errors
+	cache := NewMapCache()
+	b := bytes.NewBuffer(nil)
+	for _, pathname := range pages {
+		pathname = filepath.Clean(pathname)
+		s := newSession(rt.templateFor(pathname), cache)
+		f, err := rt.preprocess(s, pathname)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not render %q: %w", pathname, err))
+			continue
+		}
+
+		// skip the page if the page, its data and dependencies are not changed.
+		// the templates included at the last render are also the dependencies
+		// since they cannot be found until the page is rendered.
+		deps := pageDeps(pathname, f, prev.Deps[pathname])
+		sum, ok := rt.digest(deps...)
+		if ok && sum == prev.Files[pathname] && fileExists(filepath.Join(dst, pathname)) {
+			manifest.Files[pathname] = sum
+			manifest.Deps[pathname] = deps
+			report.Skipped = append(report.Skipped, pathname)
+			continue
+		}
+
+		b.Reset()
+		if err = rt.renderPage(b, s, f); err != nil {
+			errs = append(errs, fmt.Errorf("could not render %q: %w", pathname, err))
+			continue
+		} else if err = writeSiteFile(dst, pathname, b.Bytes()); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// the dependencies are updated by the templates included by the render
+		deps = pageDeps(pathname, f, nil)
+		if sum, ok = rt.digest(deps...); ok {
+			manifest.Files[pathname] = sum
+			manifest.Deps[pathname] = deps
+		}
+		report.Rendered = append(report.Rendered, pathname)
+	}
+
+	for _, pathname := range assets {
+		if datafiles[pathname] {
+			continue
+		}
+
+		b, err := rt.readfn(pathname)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sum, _ := rt.digest(pathname)
+		if sum == prev.Files[pathname] && fileExists(filepath.Join(dst, pathname)) {
+			manifest.Files[pathname] = sum
+			report.Skipped = append(report.Skipped, pathname)
+			continue
+		} else if err = writeSiteFile(dst, pathname, b); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		manifest.Files[pathname] = sum
+		report.Copied = append(report.Copied, pathname)
+	}
+
+	if err = os.MkdirAll(dst, 0755); err != nil {
+		errs = append(errs, err)
+	} else if err = manifest.write(dst); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return report, errs
+	}
+	return report, nil
+}
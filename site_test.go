@@ -0,0 +1,215 @@
+package templatex
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mah0x211/templatex/builtins"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntime_BuildSite(t *testing.T) {
+	// setup
+	srcdir, err := ioutil.TempDir("", "templatex")
+	assert.NoError(t, err)
+	defer os.RemoveAll(srcdir)
+	dstdir, err := ioutil.TempDir("", "templatex")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dstdir)
+	writeFile := func(pathname, content string) {
+		pathname = filepath.Join(srcdir, pathname)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(pathname), 0755))
+		assert.NoError(t, ioutil.WriteFile(pathname, []byte(content), 0644))
+	}
+	readFile := func(pathname string) string {
+		b, err := ioutil.ReadFile(filepath.Join(dstdir, pathname))
+		assert.NoError(t, err)
+		return string(b)
+	}
+	for pathname, content := range map[string]string{
+		"@layout.html":      `<body>{{template "content" .}}</body>`,
+		"@nav.html":         `{{define "@nav.html"}}nav{{end}}`,
+		"@errors/404.html":  `not found`,
+		"index.html":        `{{define "content"}}{{template "@nav.html"}} {{.Title}}{{end}}{{layout "@layout.html"}}`,
+		"index.json":        `{"Title": "<index>"}`,
+		"docs/about.html":   `{{define "content"}}about{{end}}{{layout "@layout.html"}}`,
+		"css/style.css":     `body {}`,
+		"img/data.json":     `{"static": true}`,
+		".hidden/file.html": `hidden`,
+	} {
+		writeFile(pathname, content)
+	}
+	rt := NewEx(DirReadFunc(srcdir), NewNopCache(), builtins.FuncMap())
+	rt.SetListFunc(DirListFunc(srcdir))
+
+	// test that render the pages and copy the static files
+	report, err := rt.BuildSite(dstdir)
+	assert.NoError(t, err)
+	assert.Equal(t, &SiteReport{
+		Rendered: []string{filepath.Join("docs", "about.html"), "index.html"},
+		Copied:   []string{filepath.Join("css", "style.css"), filepath.Join("img", "data.json")},
+	}, report)
+	assert.Equal(t, "<body>nav &lt;index&gt;</body>", readFile("index.html"))
+	assert.Equal(t, "<body>about</body>", readFile("docs/about.html"))
+	assert.Equal(t, "body {}", readFile("css/style.css"))
+	assert.True(t, fileExists(filepath.Join(dstdir, SiteManifest)))
+	for _, pathname := range []string{"@layout.html", "@errors/404.html", "index.json", ".hidden/file.html"} {
+		assert.False(t, fileExists(filepath.Join(dstdir, pathname)))
+	}
+
+	// test that skip the unchanged files
+	report, err = rt.BuildSite(dstdir)
+	assert.NoError(t, err)
+	assert.Equal(t, &SiteReport{
+		Skipped: []string{
+			filepath.Join("docs", "about.html"), "index.html",
+			filepath.Join("css", "style.css"), filepath.Join("img", "data.json"),
+		},
+	}, report)
+
+	// test that render the pages that depend on the changed files
+	writeFile("@nav.html", `{{define "@nav.html"}}menu{{end}}`)
+	writeFile("css/style.css", `body { margin: 0 }`)
+	report, err = rt.BuildSite(dstdir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"index.html"}, report.Rendered)
+	assert.Equal(t, []string{filepath.Join("css", "style.css")}, report.Copied)
+	assert.Equal(t, "<body>menu &lt;index&gt;</body>", readFile("index.html"))
+
+	writeFile("index.json", `{"Title": "new"}`)
+	writeFile("@layout.html", `<main>{{template "content" .}}</main>`)
+	report, err = rt.BuildSite(dstdir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join("docs", "about.html"), "index.html"}, report.Rendered)
+	assert.Equal(t, "<main>menu new</main>", readFile("index.html"))
+
+	// test that render the page again if the output is removed
+	assert.NoError(t, os.Remove(filepath.Join(dstdir, "index.html")))
+	report, err = rt.BuildSite(dstdir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"index.html"}, report.Rendered)
+
+	// test that returns all errors and builds the other pages
+	writeFile("broken.html", `{{template "@missing.html"}}`)
+	writeFile("invalid_data.html", `hello`)
+	writeFile("invalid_data.json", `[]`)
+	writeFile("docs/about.html", `{{define "content"}}about us{{end}}{{layout "@layout.html"}}`)
+	report, err = rt.BuildSite(dstdir)
+	assert.IsType(t, Errors{}, err)
+	assert.Len(t, err, 2)
+	assert.Regexp(t, `could not render "broken.html": could not preprocess {{template "@missing.html"}}`, err.(Errors)[0])
+	assert.Regexp(t, `could not render "invalid_data.html": could not decode "invalid_data.json"`, err.(Errors)[1])
+	assert.Equal(t, []string{filepath.Join("docs", "about.html")}, report.Rendered)
+	assert.Equal(t, "<main>about us</main>", readFile("docs/about.html"))
+
+	// test that returns an error if the pattern is invalid
+	_, err = rt.BuildSite(dstdir, "[")
+	assert.Regexp(t, `invalid pattern`, err)
+}
+
+func TestRuntime_BuildSiteIncludes(t *testing.T) {
+	// setup
+	srcdir, err := ioutil.TempDir("", "templatex")
+	assert.NoError(t, err)
+	defer os.RemoveAll(srcdir)
+	dstdir, err := ioutil.TempDir("", "templatex")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dstdir)
+	writeFile := func(pathname, content string) {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(srcdir, pathname), []byte(content), 0644))
+	}
+	readFile := func(pathname string) string {
+		b, err := ioutil.ReadFile(filepath.Join(dstdir, pathname))
+		assert.NoError(t, err)
+		return string(b)
+	}
+	writeFile("@btn.html", `button`)
+	writeFile("@card.html", `[{{.Slot}}]`)
+	writeFile("index.html", `{{include "@btn.html" .}} {{component "@card.html"}}card{{end}}`)
+	writeFile("about.html", `about`)
+	rt := NewEx(DirReadFunc(srcdir), NewNopCache(), builtins.FuncMap())
+	rt.SetListFunc(DirListFunc(srcdir))
+	report, err := rt.BuildSite(dstdir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"about.html", "index.html"}, report.Rendered)
+	assert.Equal(t, "button [card]", readFile("index.html"))
+
+	// test that render the page that includes the changed templates
+	for _, v := range []struct {
+		pathname string
+		content  string
+		output   string
+	}{
+		{pathname: "@btn.html", content: `link`, output: "link [card]"},
+		{pathname: "@card.html", content: `({{.Slot}})`, output: "link (card)"},
+	} {
+		writeFile(v.pathname, v.content)
+		report, err = rt.BuildSite(dstdir)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"index.html"}, report.Rendered)
+		assert.Equal(t, []string{"about.html"}, report.Skipped)
+		assert.Equal(t, v.output, readFile("index.html"))
+	}
+
+	// test that skip the page if the included templates are not changed
+	report, err = rt.BuildSite(dstdir)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Rendered)
+	assert.Equal(t, []string{"about.html", "index.html"}, report.Skipped)
+
+	// test that the loader may wrap the errors of the missing data files
+	readfn := DirReadFunc(srcdir)
+	rt = NewEx(func(pathname string) ([]byte, error) {
+		b, err := readfn(pathname)
+		if err != nil {
+			return nil, fmt.Errorf("could not load %q: %w", pathname, err)
+		}
+		return b, nil
+	}, NewNopCache(), builtins.FuncMap())
+	rt.SetListFunc(DirListFunc(srcdir))
+	assert.NoError(t, os.RemoveAll(dstdir))
+	report, err = rt.BuildSite(dstdir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"about.html", "index.html"}, report.Rendered)
+	report, err = rt.BuildSite(dstdir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"about.html", "index.html"}, report.Skipped)
+}
+
+func TestRuntime_BuildSiteIntoSource(t *testing.T) {
+	// setup
+	srcdir, err := ioutil.TempDir("", "templatex")
+	assert.NoError(t, err)
+	defer os.RemoveAll(srcdir)
+	dstdir := filepath.Join(srcdir, "public")
+	for pathname, content := range map[string]string{
+		"index.html":    `index`,
+		"css/style.css": `body {}`,
+	} {
+		pathname = filepath.Join(srcdir, pathname)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(pathname), 0755))
+		assert.NoError(t, ioutil.WriteFile(pathname, []byte(content), 0644))
+	}
+	rt := NewEx(DirReadFunc(srcdir), NewNopCache(), builtins.FuncMap())
+	rt.SetListFunc(DirListFunc(srcdir))
+
+	// test that the output directory under the source directory is not built
+	// as the source
+	for i := 0; i < 3; i++ {
+		report, err := rt.BuildSite(dstdir)
+		assert.NoError(t, err)
+		if i == 0 {
+			assert.Equal(t, []string{"index.html"}, report.Rendered)
+			assert.Equal(t, []string{filepath.Join("css", "style.css")}, report.Copied)
+		} else {
+			assert.Empty(t, report.Rendered)
+			assert.Empty(t, report.Copied)
+			assert.Equal(t, []string{"index.html", filepath.Join("css", "style.css")}, report.Skipped)
+		}
+	}
+	assert.True(t, fileExists(filepath.Join(dstdir, "index.html")))
+	assert.False(t, fileExists(filepath.Join(dstdir, "public")))
+}
@@ -0,0 +1,143 @@
+package templatex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// stack is the contents pushed to the named stack in a render
+type stack struct {
+	contents []string
+	keys     map[string]bool
+}
+
+// stackMarker returns the placeholder of the stack that is replaced with the
+// contents after the rendering
+func stackMarker(name string) string {
+	return "\x00stack:" + name + "\x00"
+}
+
+// stackRecord is the stacks emitted and the contents pushed while the body of
+// {{cache}} is rendered. it is stored with the output of the body to restore
+// them when the stored output is used.
+type stackRecord struct {
+	Markers []string     `json:"markers,omitempty"`
+	Pushes  []pushRecord `json:"pushes,omitempty"`
+}
+
+type pushRecord struct {
+	Name    string `json:"name"`
+	Key     string `json:"key,omitempty"`
+	Keyed   bool   `json:"keyed,omitempty"`
+	Content string `json:"content"`
+}
+
+func (x *execution) stackOf(name string) *stack {
+	if x.stacks == nil {
+		x.stacks = make(map[string]*stack)
+	}
+	s := x.stacks[name]
+	if s == nil {
+		s = &stack{
+			keys: make(map[string]bool),
+		}
+		x.stacks[name] = s
+	}
+	return s
+}
+
+// push renders the body and pushes it to the stack of name. if the key is
+// specified, the body is pushed only once for each key.
+//
+//	{{push "scripts" "jquery"}}<script src="jquery.js"></script>{{end}}
+func (x *execution) push(name string, args ...interface{}) (string, error) {
+	b, args := lastBody(args)
+	if b == nil {
+		return "", fmt.Errorf("push %q must be used as {{push name [key]}}...{{end}}", name)
+	} else if len(args) > 1 {
+		return "", fmt.Errorf("push %q: too many arguments", name)
+	}
+
+	p := pushRecord{
+		Name:  name,
+		Keyed: len(args) == 1,
+	}
+	s := x.stackOf(name)
+	pushed := false
+	if p.Keyed {
+		p.Key = fmt.Sprint(args[0])
+		if pushed = s.keys[p.Key]; pushed && len(x.records) == 0 {
+			return "", nil
+		}
+		s.keys[p.Key] = true
+	}
+
+	// the body pushed already is rendered to record it for the other renders
+	content, err := b.render()
+	if err != nil {
+		return "", err
+	}
+	p.Content = content
+	for _, r := range x.records {
+		r.Pushes = append(r.Pushes, p)
+	}
+	if !pushed {
+		s.contents = append(s.contents, content)
+	}
+	return "", nil
+}
+
+// stack emits the contents pushed to the stack of name. the contents pushed
+// after the stack is emitted are also emitted.
+func (x *execution) stack(name string) interface{} {
+	x.markStack(name)
+	return x.t.renderer.Raw(stackMarker(name))
+}
+
+func (x *execution) markStack(name string) {
+	if x.markers == nil {
+		x.markers = make(map[string]bool)
+	}
+	x.markers[name] = true
+	for _, r := range x.records {
+		r.Markers = append(r.Markers, name)
+	}
+}
+
+// restoreStacks restores the stacks emitted and the contents pushed by the
+// stored output of {{cache}}
+func (x *execution) restoreStacks(r *stackRecord) {
+	for _, name := range r.Markers {
+		x.markStack(name)
+	}
+	for _, p := range r.Pushes {
+		s := x.stackOf(p.Name)
+		if p.Keyed {
+			if s.keys[p.Key] {
+				continue
+			}
+			s.keys[p.Key] = true
+		}
+		s.contents = append(s.contents, p.Content)
+	}
+	// the outer bodies of {{cache}} record them as well
+	for _, rec := range x.records {
+		rec.Pushes = append(rec.Pushes, r.Pushes...)
+	}
+}
+
+// replaceStacks replaces the placeholders of the stacks in s with the contents
+func (x *execution) replaceStacks(s string) string {
+	if len(x.markers) == 0 {
+		return s
+	}
+	pairs := make([]string, 0, len(x.markers)*2)
+	for name := range x.markers {
+		var content string
+		if st := x.stacks[name]; st != nil {
+			content = strings.Join(st.contents, "")
+		}
+		pairs = append(pairs, stackMarker(name), content)
+	}
+	return strings.NewReplacer(pairs...).Replace(s)
+}
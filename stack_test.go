@@ -0,0 +1,65 @@
+package templatex
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+
+	"github.com/mah0x211/templatex/builtins"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntime_PushStack(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@layout.html": `<head>{{stack "styles"}}</head><body>{{template "content" .}}{{stack "scripts"}}{{stack "empty"}}</body>`,
+		"@chart.html": `{{define "@chart.html"}}` +
+			`{{push "scripts" "chart"}}<script src="chart.js"></script>{{end}}` +
+			`{{push "scripts"}}<script>draw({{.}})</script>{{end}}` +
+			`<canvas></canvas>{{end}}`,
+		"@card.html": `{{push "styles" "card"}}<link href="card.css">{{end}}<div>{{.Slot}}</div>`,
+		"index.html": `{{define "content"}}` +
+			`{{range .Charts}}{{template "@chart.html" .}}{{end}}` +
+			`{{component "@card.html"}}{{include "@card.html" (props "Slot" .Title)}}{{end}}` +
+			`{{end}}{{layout "@layout.html"}}`,
+		"index.txt":    `{{stack "items"}}{{range .Items}}{{push "items"}}[{{.}}]{{end}}{{end}}`,
+		"invalid.html": `{{print (push "scripts")}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	rt := NewEx(readfn, NewMapCache(), builtins.FuncMap())
+
+	// test that emit the contents pushed from the templates, includes and
+	// components
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt.RenderHTML(b, "index.html", map[string]interface{}{
+		"Charts": []string{"a", "b"},
+		"Title":  "<title>",
+	}))
+	assert.Equal(t, `<head><link href="card.css"></head>`+
+		`<body><canvas></canvas><canvas></canvas><div><div>&lt;title&gt;</div></div>`+
+		`<script src="chart.js"></script><script>draw("a")</script><script>draw("b")</script></body>`, b.String())
+
+	// test that the stacks are not shared between the renders
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "index.html", map[string]interface{}{
+		"Charts": []string{"c"},
+	}))
+	assert.Equal(t, `<head><link href="card.css"></head>`+
+		`<body><canvas></canvas><div><div></div></div>`+
+		`<script src="chart.js"></script><script>draw("c")</script></body>`, b.String())
+
+	// test that emit the contents pushed after the stack with text/template
+	b.Reset()
+	assert.NoError(t, rt.RenderText(b, "index.txt", map[string]interface{}{"Items": []string{"a", "<b>"}}))
+	assert.Equal(t, "[a][<b>]", b.String())
+
+	// test that returns an error if push is used without the body
+	err := rt.RenderHTML(bytes.NewBuffer(nil), "invalid.html", nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `push "scripts" must be used as {{push name [key]}}...{{end}}`)
+}
@@ -0,0 +1,104 @@
+package templatex
+
+import (
+	"errors"
+	"fmt"
+	"text/template/parse"
+)
+
+// superFunc is the placeholder of {{super}}. the {{super}} actions are
+// replaced with the template calls when parsing, so it will be called only
+// if it is used in the other forms.
+func superFunc() (string, error) {
+	return "", errors.New("super must be used as {{super}} in {{define}} or {{block}}")
+}
+
+// superName returns the name of the template that renders the template name
+// of the layout
+func superName(layout *File, name string) string {
+	return "super:" + layout.name + ":" + name
+}
+
+// isSuperCall returns true if the action is {{super}}
+func isSuperCall(a *parse.ActionNode) bool {
+	if len(a.Pipe.Decl) > 0 || len(a.Pipe.Cmds) != 1 || len(a.Pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	ident, ok := a.Pipe.Cmds[0].Args[0].(*parse.IdentifierNode)
+	return ok && ident.Ident == "super"
+}
+
+// replaceSuper replaces the {{super}} actions in the list with
+// {{template "name" $}} and returns true if replaced.
+func replaceSuper(list *parse.ListNode, name string) bool {
+	if list == nil {
+		return false
+	}
+
+	found := false
+	for i, n := range list.Nodes {
+		var branch *parse.BranchNode
+		switch n := n.(type) {
+		case *parse.ActionNode:
+			if isSuperCall(n) {
+				pipe := n.Pipe
+				pipe.Cmds[0].Args[0] = &parse.VariableNode{
+					NodeType: parse.NodeVariable,
+					Pos:      n.Pos,
+					Ident:    []string{"$"},
+				}
+				list.Nodes[i] = &parse.TemplateNode{
+					NodeType: parse.NodeTemplate,
+					Pos:      n.Pos,
+					Line:     n.Line,
+					Name:     name,
+					Pipe:     pipe,
+				}
+				found = true
+			}
+			continue
+		case *parse.IfNode:
+			branch = &n.BranchNode
+		case *parse.RangeNode:
+			branch = &n.BranchNode
+		case *parse.WithNode:
+			branch = &n.BranchNode
+		default:
+			continue
+		}
+		if replaceSuper(branch.List, name) {
+			found = true
+		}
+		if replaceSuper(branch.ElseList, name) {
+			found = true
+		}
+	}
+	return found
+}
+
+// bindSuper binds the {{super}} actions in the templates defined by f to the
+// templates of the layout that they override. parents are the templates of
+// the layout before f is parsed.
+func (t *Template) bindSuper(f *File, layout *File, parents map[string]*parse.Tree) error {
+	for name, tree := range t.renderer.Trees(f.tmpl) {
+		if tree.ParseName != f.name {
+			continue
+		}
+
+		var sname string
+		if layout != nil {
+			sname = superName(layout, name)
+		}
+		if !replaceSuper(tree.Root, sname) {
+			continue
+		}
+
+		parent, ok := parents[name]
+		if !ok {
+			return fmt.Errorf("%q in %q calls {{super}} but the layout does not define it", name, f.name)
+		} else if err := t.renderer.AddTree(f.tmpl, sname, parent.Copy()); err != nil {
+			return fmt.Errorf("could not attach super template of %q to %q: %v", name, f.name, err)
+		}
+	}
+	return nil
+}
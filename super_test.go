@@ -0,0 +1,82 @@
+package templatex
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+
+	"github.com/mah0x211/templatex/builtins"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntime_Super(t *testing.T) {
+	// setup
+	files := map[string]string{
+		"@base.html": `<html>{{block "head" .}}<title>{{.Title}}</title>{{end}}` +
+			`{{block "content" .}}{{end}}` +
+			`{{block "scripts" .}}<script src="base.js"></script>{{end}}</html>`,
+		"@section.html": `{{define "head"}}{{super}}<link href="section.css">{{end}}` +
+			`{{define "content"}}<section>{{block "body" .}}{{end}}</section>{{end}}` +
+			`{{layout "@base.html"}}`,
+		"single.html": `{{define "head"}}<meta>{{super}}{{end}}` +
+			`{{define "content"}}single{{end}}` +
+			`{{layout "@base.html"}}`,
+		"multi.html": `{{define "head"}}{{super}}<link href="page.css">{{end}}` +
+			`{{define "scripts"}}{{range .Scripts}}{{super}}<script src="{{.}}"></script>{{end}}{{end}}` +
+			`{{define "body"}}multi{{end}}` +
+			`{{layout "@section.html"}}`,
+		"nolayout.html":  `{{define "head"}}{{super}}{{end}}hello`,
+		"noparent.html":  `{{define "footer"}}{{super}}{{end}}{{layout "@base.html"}}`,
+		"pipeline.html":  `{{define "head"}}{{super | print}}{{end}}{{layout "@base.html"}}`,
+		"toplevel.html":  `{{define "content"}}{{end}}{{layout "@base.html"}}{{super}}`,
+		"overwrite.html": `{{define "head"}}<title>overwritten</title>{{end}}{{layout "@section.html"}}`,
+	}
+	readfn := func(pathname string) ([]byte, error) {
+		if s, ok := files[pathname]; ok {
+			return []byte(s), nil
+		}
+		return nil, syscall.ENOENT
+	}
+	rt := NewEx(readfn, NewMapCache(), builtins.FuncMap())
+	data := map[string]interface{}{
+		"Title":   "<title>",
+		"Scripts": []string{"a.js"},
+	}
+
+	// test that super renders the block of the layout
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, rt.RenderHTML(b, "single.html", data))
+	assert.Equal(t, `<html><meta><title>&lt;title&gt;</title>single<script src="base.js"></script></html>`, b.String())
+
+	// test that super renders the blocks through the layout chain with the
+	// data passed to the template
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "multi.html", data))
+	assert.Equal(t, `<html><title>&lt;title&gt;</title><link href="section.css"><link href="page.css">`+
+		`<section>multi</section>`+
+		`<script src="base.js"></script><script src="a.js"></script></html>`, b.String())
+
+	// test that the template without super overwrites the block
+	b.Reset()
+	assert.NoError(t, rt.RenderHTML(b, "overwrite.html", data))
+	assert.Equal(t, `<html><title>overwritten</title><section></section><script src="base.js"></script></html>`, b.String())
+
+	// test that super works with text/template
+	b.Reset()
+	assert.NoError(t, rt.RenderText(b, "single.html", data))
+	assert.Equal(t, `<html><meta><title><title></title>single<script src="base.js"></script></html>`, b.String())
+
+	// test that returns an error if the layout does not define the template
+	for _, name := range []string{"nolayout.html", "noparent.html", "toplevel.html"} {
+		b.Reset()
+		err := rt.RenderHTML(b, name, data)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "calls {{super}} but the layout does not define it")
+	}
+
+	// test that returns an error if super is used in the other form
+	b.Reset()
+	err := rt.RenderHTML(b, "pipeline.html", data)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "super must be used as {{super}}")
+}
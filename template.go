@@ -1,8 +1,10 @@
 package templatex
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"text/template/parse"
 )
 
 type xRenderer interface {
@@ -10,7 +12,11 @@ type xRenderer interface {
 	IsNil(tmpl interface{}) bool
 	NewTemplate(name string, funcs map[string]interface{}) interface{}
 	AddParseTree(dst, src interface{}) error
+	Trees(tmpl interface{}) map[string]*parse.Tree
+	AddTree(tmpl interface{}, name string, tree *parse.Tree) error
 	Lookup(tmpl interface{}, name string) (interface{}, bool)
+	Funcs(tmpl interface{}, funcs map[string]interface{})
+	Raw(s string) interface{}
 	ParseString(tmpl interface{}, str string) (interface{}, error)
 	Execute(tmpl interface{}, w io.Writer, data interface{}) error
 }
@@ -18,19 +24,46 @@ type xRenderer interface {
 type Template struct {
 	*Runtime
 	renderer xRenderer
+	funcs    map[string]interface{}
+}
+
+// newFuncMap returns the copy of funcs with the functions provided by the
+// runtime. it panics if funcs contains the name of the runtime function.
+func newFuncMap(funcs map[string]interface{}) map[string]interface{} {
+	rtfuncs := map[string]interface{}{
+		"super": superFunc,
+		"props": props,
+	}
+	for name := range (&execution{}).funcs() {
+		rtfuncs[name] = unboundFunc(name)
+	}
+
+	m := make(map[string]interface{}, len(funcs)+len(rtfuncs))
+	for k, v := range funcs {
+		if _, ok := rtfuncs[k]; ok {
+			panic(fmt.Errorf("function %q cannot be defined: the name is reserved by the runtime", k))
+		}
+		m[k] = v
+	}
+	for k, v := range rtfuncs {
+		m[k] = v
+	}
+	return m
 }
 
 func NewTemplate(rt *Runtime, renderer xRenderer) *Template {
 	return &Template{
 		Runtime:  rt,
 		renderer: renderer,
+		funcs:    newFuncMap(rt.funcs),
 	}
 }
 
 func (t *Template) Parse(f *File, text string, layout *File, includes map[string]*File) error {
 	f.tmpl = t.renderer.NewTemplate(f.name, t.funcs)
 	f.root = f.tmpl
-	var child map[string]*File
+	f.digest = fileDigest(f.name, text, layout, includes)
+	var parents map[string]*parse.Tree
 	if layout != nil {
 		// NOTE: layout template will be the root template but it cannot be
 		// parsed more than twice. so, it must use the cloned template.
@@ -40,16 +73,19 @@ func (t *Template) Parse(f *File, text string, layout *File, includes map[string
 			return err
 		}
 
-		root, ok := t.renderer.Lookup(f.tmpl, layout.Name())
+		parents = t.renderer.Trees(f.tmpl)
+
+		// the root template is the top of the layout chain
+		top := topLayout(layout)
+		root, ok := t.renderer.Lookup(f.tmpl, top.Name())
 		if !ok {
 			// layout template name
 			panic(fmt.Errorf(
 				"layout template %q not found: template name must be same as filename",
-				layout.Name(),
+				top.Name(),
 			))
 		}
 		f.root = root
-		child = layout.child
 	}
 
 	// attach associated templates
@@ -59,20 +95,57 @@ func (t *Template) Parse(f *File, text string, layout *File, includes map[string
 		}
 	}
 
-	if _, err := t.renderer.ParseString(f.tmpl, text); err != nil {
+	if _, err := t.renderer.ParseString(f.tmpl, markBlockActions(f, text)); err != nil {
+		return err
+	} else if err = t.bindSuper(f, layout, parents); err != nil {
+		return err
+	} else if err = t.bindBlockActions(f); err != nil {
 		return err
 	}
-	for _, c := range child {
-		c.addParent(f)
+	// the file depends on all the layouts in the chain and their includes
+	for l := layout; l != nil; l = l.layout {
+		l.addParent(f)
+		for _, c := range l.children() {
+			c.addParent(f)
+		}
 	}
 
 	return nil
 }
 
-func (t *Template) Render(w io.Writer, pathname string, data map[string]interface{}) error {
-	f, err := t.preprocess(t, pathname, make(map[string]struct{}))
+// load preprocesses the template to render with the options
+func (t *Template) load(s *session, pathname string, o *renderOptions) (*File, error) {
+	if o.layout != "" {
+		return t.preprocessLayout(s, pathname, o.layout)
+	}
+	return t.preprocess(s, pathname)
+}
+
+func (t *Template) Render(w io.Writer, pathname string, data map[string]interface{}, opts ...RenderOption) error {
+	s := newSession(t, t.Cache())
+	f, err := t.load(s, pathname, newRenderOptions(opts))
 	if err != nil {
 		return err
 	}
-	return t.renderer.Execute(f.root, w, data)
+	return t.execute(s, f, w, data)
+}
+
+func (t *Template) execute(s *session, f *File, w io.Writer, data map[string]interface{}) error {
+	// pass the front matter as .Page unless the data has it
+	if _, exists := data["Page"]; f.meta != nil && !exists {
+		v := make(map[string]interface{}, len(data)+1)
+		for k, val := range data {
+			v[k] = val
+		}
+		v["Page"] = f.meta
+		data = v
+	}
+	// render into the buffer to replace the stacks with their contents
+	b := bytes.NewBuffer(nil)
+	x := &execution{t: t, s: s}
+	if err := x.execute(f, b, data); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, x.replaceStacks(b.String()))
+	return err
 }
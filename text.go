@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"text/template"
+	"text/template/parse"
 )
 
 type Text struct{}
@@ -45,11 +46,36 @@ func (_ Text) AddParseTree(dst, src interface{}) error {
 	return nil
 }
 
+// Trees returns the parse trees of the templates associated with tmpl
+func (_ Text) Trees(tmpl interface{}) map[string]*parse.Tree {
+	trees := make(map[string]*parse.Tree)
+	for _, t := range tmpl.(*template.Template).Templates() {
+		if t.Tree != nil {
+			trees[t.Name()] = t.Tree
+		}
+	}
+	return trees
+}
+
+func (_ Text) AddTree(tmpl interface{}, name string, tree *parse.Tree) error {
+	_, err := tmpl.(*template.Template).AddParseTree(name, tree)
+	return err
+}
+
 func (_ Text) Lookup(tmpl interface{}, name string) (interface{}, bool) {
 	t := tmpl.(*template.Template).Lookup(name)
 	return t, t != nil
 }
 
+func (_ Text) Funcs(tmpl interface{}, funcs map[string]interface{}) {
+	tmpl.(*template.Template).Funcs(funcs)
+}
+
+// Raw returns s as the value that is written without escaping
+func (_ Text) Raw(s string) interface{} {
+	return s
+}
+
 func (_ Text) ParseString(tmpl interface{}, str string) (interface{}, error) {
 	return tmpl.(*template.Template).Parse(str)
 }
@@ -94,6 +94,51 @@ func TestText_AddParseTree(t *testing.T) {
 	assert.True(t, lookup(a, "baz_content"))
 }
 
+func TestText_Trees_AddTree(t *testing.T) {
+	r := Text{}
+	tmpl := r.NewTemplate("foo", nil)
+	_, err := r.ParseString(tmpl, `{{define "bar"}}bar{{end}}foo {{template "baz"}}`)
+	assert.NoError(t, err)
+
+	// test that returns the parse trees of the associated templates
+	trees := r.Trees(tmpl)
+	assert.Len(t, trees, 2)
+	assert.Equal(t, "foo", trees["foo"].Name)
+	assert.Equal(t, "bar", trees["bar"].Name)
+
+	// test that add the parse tree with the name
+	assert.NoError(t, r.AddTree(tmpl, "baz", trees["bar"].Copy()))
+	_, ok := r.Lookup(tmpl, "baz")
+	assert.True(t, ok)
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, r.Execute(tmpl, b, nil))
+	assert.Equal(t, "foo bar", b.String())
+}
+
+func TestText_Funcs(t *testing.T) {
+	r := Text{}
+	tmpl := r.NewTemplate("foo", map[string]interface{}{
+		"greet": func() string { return "hello" },
+	})
+	_, err := r.ParseString(tmpl, `{{greet}}`)
+	assert.NoError(t, err)
+
+	// test that replace the functions
+	r.Funcs(tmpl, map[string]interface{}{
+		"greet": func() string { return "bye" },
+	})
+	b := bytes.NewBuffer(nil)
+	assert.NoError(t, r.Execute(tmpl, b, nil))
+	assert.Equal(t, "bye", b.String())
+}
+
+func TestText_Raw(t *testing.T) {
+	r := Text{}
+
+	// test that returns the value that is not escaped
+	assert.Equal(t, "<b>", r.Raw("<b>"))
+}
+
 func TestText_ParseString(t *testing.T) {
 	r := Text{}
 	tmpl := r.NewTemplate("foo", nil)